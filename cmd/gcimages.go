@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/somos831/somos-backend/config"
+	conn "github.com/somos831/somos-backend/db"
+	"github.com/somos831/somos-backend/handlers"
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/models"
+)
+
+// gcImages removes uploaded images that no event, user or organization uses,
+// along with their files, once they are older than the grace period.
+//
+//	go run ./cmd gc-images -grace 1h
+func gcImages(args []string) {
+	flags := flag.NewFlagSet("gc-images", flag.ExitOnError)
+	grace := flags.Duration("grace", 24*time.Hour,
+		"how long unreferenced uploads are kept before being removed")
+	_ = flags.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = logging.Setup(cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := handlers.NewStorage(cfg.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := handlers.ConnectDB(cfg.Database)
+	defer conn.Disconnect(db)
+
+	cutoff := time.Now().Add(-*grace)
+
+	removed, err := models.CollectImageGarbage(context.Background(), db, store, cutoff, 100)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.Info("removed unreferenced images",
+		"count", removed, "uploaded_before", cutoff.Format(time.RFC3339))
+}
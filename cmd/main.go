@@ -1,10 +1,32 @@
 package main
 
-import "github.com/somos831/somos-backend/handlers"
+import (
+	"log"
+	"os"
+
+	"github.com/somos831/somos-backend/config"
+	"github.com/somos831/somos-backend/handlers"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "purge":
+			purge(os.Args[2:])
+			return
+		case "gc-images":
+			gcImages(os.Args[2:])
+			return
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	server := handlers.Server{}
 
-	server.InitServer()
-	server.Run(":8080")
+	server.InitServer(cfg)
+	server.Run(cfg.Addr)
 }
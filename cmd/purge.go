@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/somos831/somos-backend/config"
+	conn "github.com/somos831/somos-backend/db"
+	"github.com/somos831/somos-backend/handlers"
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/models"
+)
+
+// purge permanently removes events, users and locations that were soft deleted
+// longer ago than the retention period.
+//
+//	go run ./cmd purge -retention 720h
+func purge(args []string) {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	retention := flags.Duration("retention", 90*24*time.Hour,
+		"how long soft-deleted rows are kept before being purged")
+	_ = flags.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = logging.Setup(cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := handlers.ConnectDB(cfg.Database)
+	defer conn.Disconnect(db)
+
+	ctx := context.Background()
+	cutoff := time.Now().Add(-*retention)
+
+	// Events go first so that locations they referenced can be purged too.
+	events, err := models.PurgeDeletedEvents(ctx, db, cutoff)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	users, err := models.PurgeDeletedUsers(ctx, db, cutoff)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	locations, err := models.PurgeDeletedLocations(ctx, db, cutoff)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.Info("purged soft-deleted rows",
+		"events", events, "users", users, "locations", locations, "deleted_before", cutoff.Format(time.RFC3339))
+}
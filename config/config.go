@@ -0,0 +1,442 @@
+// Package config loads the server's configuration from, in order of
+// precedence, environment variables, an optional .env file and an optional
+// YAML file named by CONFIG_FILE.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/mail"
+	"net/netip"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the server and its commands. Each field is
+// set by the environment variable in its env tag, or by the key in its yaml
+// tag in the config file.
+type Config struct {
+	// Addr is the address the server listens on.
+	Addr string `yaml:"addr" env:"ADDR"`
+	// MetricsAddr is the address Prometheus metrics are served on, apart
+	// from the API so that they aren't public. They aren't served when it is
+	// empty.
+	MetricsAddr string   `yaml:"metrics_addr" env:"METRICS_ADDR"`
+	HTTP        HTTP     `yaml:"http"`
+	Database    Database `yaml:"database"`
+	Log         Log      `yaml:"log"`
+	Tracing     Tracing  `yaml:"tracing"`
+	Geocoder    Geocoder `yaml:"geocoder"`
+	SMTP        SMTP     `yaml:"smtp"`
+	Storage     Storage  `yaml:"storage"`
+	ImageGC     ImageGC  `yaml:"image_gc"`
+	Features    Features `yaml:"features"`
+	// InvitationURL is the address of the page accepting organization
+	// invitations, the invitation token is appended to it.
+	InvitationURL string `yaml:"invitation_url" env:"INVITATION_URL"`
+}
+
+// HTTP configures the timeouts of the HTTP server.
+type HTTP struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	// RequestTimeout bounds the context of every request.
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"HTTP_REQUEST_TIMEOUT"`
+	// ShutdownTimeout is how long requests being served are given to
+	// complete when the server shuts down.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay is how long the server keeps accepting requests after it
+	// starts reporting that it isn't ready, when shutting down.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	// TrustedProxies are the addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For header is trusted to tell the client's address, comma
+	// separated in the environment.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Database configures the MySQL connection and its pool.
+type Database struct {
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD"`
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            string        `yaml:"port" env:"DB_PORT"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+// Log configures logging. Level is debug, info, warn or error and Format
+// json or text.
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Tracing configures where spans are exported, "none" or "otlp". The OTLP
+// exporter reads the collector's address from the standard
+// OTEL_EXPORTER_OTLP_* variables.
+type Tracing struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+}
+
+// Geocoder configures the Nominatim server used to geocode location
+// addresses. Locations aren't geocoded without a URL.
+type Geocoder struct {
+	URL       string `yaml:"url" env:"GEOCODER_URL"`
+	UserAgent string `yaml:"user_agent" env:"GEOCODER_USER_AGENT"`
+}
+
+// SMTP configures the server sending emails. Emails are only logged without
+// an Addr.
+type SMTP struct {
+	Addr     string `yaml:"addr" env:"SMTP_ADDR"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// Storage configures where uploaded images are kept, either "local" or "s3".
+type Storage struct {
+	Backend    string `yaml:"backend" env:"STORAGE_BACKEND"`
+	UploadsDir string `yaml:"uploads_dir" env:"UPLOADS_DIR"`
+	UploadsURL string `yaml:"uploads_url" env:"UPLOADS_URL"`
+	S3         S3     `yaml:"s3"`
+}
+
+// S3 configures an S3 compatible object store.
+type S3 struct {
+	Endpoint        string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	Region          string `yaml:"region" env:"S3_REGION"`
+	Bucket          string `yaml:"bucket" env:"S3_BUCKET"`
+	AccessKeyId     string `yaml:"access_key_id" env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	PublicURL       string `yaml:"public_url" env:"S3_PUBLIC_URL"`
+}
+
+// ImageGC configures how often unreferenced images are removed, 0 disabling
+// it, and how long new uploads are kept before they can be.
+type ImageGC struct {
+	Interval time.Duration `yaml:"interval" env:"IMAGE_GC_INTERVAL"`
+	Grace    time.Duration `yaml:"grace" env:"IMAGE_GC_GRACE"`
+}
+
+// Features turns parts of the API on or off.
+type Features struct {
+	// Uploads accepts image uploads.
+	Uploads bool `yaml:"uploads" env:"FEATURE_UPLOADS"`
+	// PhotoSubmissions lets members who don't manage an event submit photos
+	// to its gallery.
+	PhotoSubmissions bool `yaml:"photo_submissions" env:"FEATURE_PHOTO_SUBMISSIONS"`
+}
+
+// Default returns the configuration used for anything left unset.
+func Default() Config {
+	return Config{
+		Addr: ":8080",
+		HTTP: HTTP{
+			ReadHeaderTimeout: 10 * time.Second,
+			// Reads allow for image uploads over slow connections.
+			ReadTimeout:     60 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			RequestTimeout:  5 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Database: Database{
+			Port:            "3306",
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 3 * time.Minute,
+		},
+		Log:     Log{Level: "info", Format: "json"},
+		Tracing: Tracing{Exporter: "none"},
+		Storage: Storage{
+			Backend:    "local",
+			UploadsDir: "uploads",
+			UploadsURL: "/uploads",
+		},
+		ImageGC: ImageGC{
+			Interval: time.Hour,
+			Grace:    24 * time.Hour,
+		},
+		Features: Features{
+			Uploads:          true,
+			PhotoSubmissions: true,
+		},
+	}
+}
+
+// Load loads and validates the configuration. Variables in a .env file in
+// the working directory are added to the environment, without overriding
+// variables already set. The YAML file named by CONFIG_FILE is read next,
+// then environment variables override its values. Neither file is required.
+func Load() (*Config, error) {
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env: %w", err)
+	}
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// loadFile reads the YAML file at path into cfg. Unknown keys are refused so
+// that typos don't go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadEnv sets the fields of the struct v from the non-empty environment
+// variables in their env tags, descending into nested structs.
+func loadEnv(v reflect.Value) error {
+	var errs []error
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				if err := loadEnv(field); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		switch field.Interface().(type) {
+		case string:
+			field.SetString(value)
+		case int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be an integer, got %q", name, value))
+				continue
+			}
+			field.SetInt(int64(n))
+		case bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false, got %q", name, value))
+				continue
+			}
+			field.SetBool(b)
+		case []string:
+			var values []string
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			field.Set(reflect.ValueOf(values))
+		case time.Duration:
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration such as 30s or 1h, got %q", name, value))
+				continue
+			}
+			field.SetInt(int64(d))
+		default:
+			panic(fmt.Sprintf("config: unsupported type %s for %s", field.Type(), name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ParsePrefix parses an IP address, as a single address range, or a CIDR
+// range such as 10.0.0.0/8.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Validate checks that required values are set and that values are in
+// range, listing every problem found. Problems are reported by the name of
+// their environment variable.
+func (c *Config) Validate() error {
+	var errs []error
+	problem := func(name, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Addr == "" {
+		problem("ADDR", "is required")
+	}
+	if c.MetricsAddr != "" && c.MetricsAddr == c.Addr {
+		problem("METRICS_ADDR", "must differ from ADDR, metrics aren't served on the API's address")
+	}
+
+	timeouts := map[string]time.Duration{
+		"HTTP_READ_HEADER_TIMEOUT": c.HTTP.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":        c.HTTP.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":       c.HTTP.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        c.HTTP.IdleTimeout,
+		"HTTP_REQUEST_TIMEOUT":     c.HTTP.RequestTimeout,
+		"SHUTDOWN_TIMEOUT":         c.HTTP.ShutdownTimeout,
+	}
+	for name, timeout := range timeouts {
+		if timeout <= 0 {
+			problem(name, "must be positive")
+		}
+	}
+	if c.HTTP.ShutdownDelay < 0 {
+		problem("SHUTDOWN_DELAY", "cannot be negative")
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if _, err := ParsePrefix(proxy); err != nil {
+			problem("TRUSTED_PROXIES", "must be IP addresses or CIDR ranges, got %q", proxy)
+		}
+	}
+
+	if c.Database.User == "" {
+		problem("DB_USER", "is required")
+	}
+	if c.Database.Host == "" {
+		problem("DB_HOST", "is required")
+	}
+	if c.Database.Name == "" {
+		problem("DB_NAME", "is required")
+	}
+	if port, err := strconv.Atoi(c.Database.Port); err != nil || port < 1 || port > 65535 {
+		problem("DB_PORT", "must be a port number, got %q", c.Database.Port)
+	}
+	if c.Database.MaxOpenConns < 0 {
+		problem("DB_MAX_OPEN_CONNS", "cannot be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		problem("DB_MAX_IDLE_CONNS", "cannot be negative")
+	} else if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problem("DB_MAX_IDLE_CONNS", "cannot be more than DB_MAX_OPEN_CONNS")
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		problem("DB_CONN_MAX_LIFETIME", "cannot be negative")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		problem("LOG_LEVEL", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		problem("LOG_FORMAT", "must be json or text, got %q", c.Log.Format)
+	}
+
+	if c.Tracing.Exporter != "none" && c.Tracing.Exporter != "otlp" {
+		problem("TRACING_EXPORTER", "must be none or otlp, got %q", c.Tracing.Exporter)
+	}
+
+	if c.Geocoder.URL != "" && c.Geocoder.UserAgent == "" {
+		problem("GEOCODER_USER_AGENT", "is required with GEOCODER_URL")
+	}
+
+	if c.SMTP.Addr != "" {
+		if c.SMTP.From == "" {
+			problem("SMTP_FROM", "is required with SMTP_ADDR")
+		} else if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			problem("SMTP_FROM", "must be an email address, got %q", c.SMTP.From)
+		}
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.UploadsDir == "" {
+			problem("UPLOADS_DIR", "is required")
+		}
+		if c.Storage.UploadsURL == "" {
+			problem("UPLOADS_URL", "is required")
+		}
+	case "s3":
+		required := map[string]string{
+			"S3_ENDPOINT":          c.Storage.S3.Endpoint,
+			"S3_REGION":            c.Storage.S3.Region,
+			"S3_BUCKET":            c.Storage.S3.Bucket,
+			"S3_ACCESS_KEY_ID":     c.Storage.S3.AccessKeyId,
+			"S3_SECRET_ACCESS_KEY": c.Storage.S3.SecretAccessKey,
+		}
+		for name, value := range required {
+			if value == "" {
+				problem(name, "is required with STORAGE_BACKEND=s3")
+			}
+		}
+	default:
+		problem("STORAGE_BACKEND", "must be local or s3, got %q", c.Storage.Backend)
+	}
+
+	if c.ImageGC.Interval < 0 {
+		problem("IMAGE_GC_INTERVAL", "cannot be negative")
+	}
+	if c.ImageGC.Grace < 0 {
+		problem("IMAGE_GC_GRACE", "cannot be negative")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	// Maps are iterated in random order, sort problems to report them
+	// consistently.
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	slices.Sort(messages)
+
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(messages, "\n  "))
+}
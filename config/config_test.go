@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envNames returns the environment variables read into the struct t.
+func envNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name := field.Tag.Get("env"); name != "" {
+			names = append(names, name)
+		} else if field.Type.Kind() == reflect.Struct {
+			names = append(names, envNames(field.Type)...)
+		}
+	}
+
+	return names
+}
+
+// isolate unsets every variable the configuration is read from, restoring
+// them when the test ends, and runs the test in an empty directory holding
+// dotenv as its .env file when not empty.
+func isolate(t *testing.T, dotenv string) string {
+	t.Helper()
+
+	for _, name := range append(envNames(reflect.TypeOf(Config{})), "CONFIG_FILE") {
+		// Setenv restores the variable when the test ends, including those
+		// set from .env by Load.
+		t.Setenv(name, "")
+		_ = os.Unsetenv(name)
+	}
+
+	dir := t.TempDir()
+	if dotenv != "" {
+		if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotenv), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	required := map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos"}
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		dotenv string
+		yaml   string
+		// want checks the loaded configuration, wantErr is part of the
+		// error otherwise.
+		want    func(t *testing.T, cfg *Config)
+		wantErr string
+	}{
+		{
+			name: "defaults without .env",
+			env:  required,
+			want: func(t *testing.T, cfg *Config) {
+				if cfg.Addr != ":8080" || cfg.Database.Port != "3306" || cfg.HTTP.ShutdownTimeout != 20*time.Second {
+					t.Errorf("Addr, DB port, shutdown timeout = %q, %q, %v, want the defaults",
+						cfg.Addr, cfg.Database.Port, cfg.HTTP.ShutdownTimeout)
+				}
+			},
+		},
+		{
+			name:   ".env below the environment",
+			env:    map[string]string{"DB_USER": "env", "DB_HOST": "localhost"},
+			dotenv: "DB_USER=dotenv\nDB_NAME=dotenv\n",
+			want: func(t *testing.T, cfg *Config) {
+				if cfg.Database.User != "env" || cfg.Database.Name != "dotenv" {
+					t.Errorf("DB user, name = %q, %q, want env, dotenv", cfg.Database.User, cfg.Database.Name)
+				}
+			},
+		},
+		{
+			name: "environment over YAML",
+			env:  map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "env", "HTTP_READ_TIMEOUT": "5s"},
+			yaml: "addr: \":9000\"\ndatabase:\n  name: yaml\nhttp:\n  read_timeout: 30s\n  write_timeout: 45s\n",
+			want: func(t *testing.T, cfg *Config) {
+				if cfg.Addr != ":9000" || cfg.Database.Name != "env" {
+					t.Errorf("Addr, DB name = %q, %q, want :9000, env", cfg.Addr, cfg.Database.Name)
+				}
+				if cfg.HTTP.ReadTimeout != 5*time.Second || cfg.HTTP.WriteTimeout != 45*time.Second {
+					t.Errorf("read, write timeouts = %v, %v, want 5s, 45s", cfg.HTTP.ReadTimeout, cfg.HTTP.WriteTimeout)
+				}
+			},
+		},
+		{
+			name: "empty YAML",
+			env:  required,
+			yaml: "# nothing set\n",
+			want: func(t *testing.T, cfg *Config) {
+				if cfg.Addr != ":8080" {
+					t.Errorf("Addr = %q, want the default", cfg.Addr)
+				}
+			},
+		},
+		{
+			name:    "unknown YAML key",
+			env:     required,
+			yaml:    "adress: \":9000\"\n",
+			wantErr: "field adress not found",
+		},
+		{
+			name:    "invalid YAML duration",
+			env:     required,
+			yaml:    "http:\n  read_timeout: soon\n",
+			wantErr: "cannot unmarshal !!str `soon` into time.Duration",
+		},
+		{
+			name:    "invalid duration",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "HTTP_READ_TIMEOUT": "30"},
+			wantErr: "HTTP_READ_TIMEOUT must be a duration",
+		},
+		{
+			name:    "negative duration",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "SHUTDOWN_TIMEOUT": "-1s"},
+			wantErr: "invalid configuration:\n  SHUTDOWN_TIMEOUT must be positive",
+		},
+		{
+			name:    "port out of range",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "DB_PORT": "70000"},
+			wantErr: "invalid configuration:\n  DB_PORT must be a port number",
+		},
+		{
+			name:    "port not a number",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "DB_PORT": "mysql"},
+			wantErr: "invalid configuration:\n  DB_PORT must be a port number",
+		},
+		{
+			name:    "invalid integer",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "DB_MAX_OPEN_CONNS": "many"},
+			wantErr: "DB_MAX_OPEN_CONNS must be an integer",
+		},
+		{
+			name: "trusted proxies",
+			env:  map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "TRUSTED_PROXIES": "10.0.0.0/8, 192.0.2.1,"},
+			want: func(t *testing.T, cfg *Config) {
+				if !slices.Equal(cfg.HTTP.TrustedProxies, []string{"10.0.0.0/8", "192.0.2.1"}) {
+					t.Errorf("TrustedProxies = %q, want 10.0.0.0/8 and 192.0.2.1", cfg.HTTP.TrustedProxies)
+				}
+			},
+		},
+		{
+			name:    "invalid trusted proxy",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "TRUSTED_PROXIES": "proxy.internal"},
+			wantErr: "invalid configuration:\n  TRUSTED_PROXIES must be IP addresses or CIDR ranges",
+		},
+		{
+			name:    "metrics on the API's address",
+			env:     map[string]string{"DB_USER": "somos", "DB_HOST": "localhost", "DB_NAME": "somos", "METRICS_ADDR": ":8080"},
+			wantErr: "invalid configuration:\n  METRICS_ADDR must differ from ADDR",
+		},
+		{
+			name:    "every problem listed",
+			wantErr: "invalid configuration:\n  DB_HOST is required\n  DB_NAME is required\n  DB_USER is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := isolate(t, test.dotenv)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if test.yaml != "" {
+				path := filepath.Join(dir, "config.yaml")
+				if err := os.WriteFile(path, []byte(test.yaml), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("CONFIG_FILE", path)
+			}
+
+			cfg, err := Load()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Load error = %v, want one with %q", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			test.want(t, cfg)
+		})
+	}
+}
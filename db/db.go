@@ -2,24 +2,39 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
-	"os"
+	"log/slog"
+	"net"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/XSAM/otelsql"
+	"github.com/go-sql-driver/mysql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func Connect() *sql.DB {
-	dbName := os.Getenv("DB_NAME")
-	addr := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		dbName,
+// Pool configures the connection pool of a database.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Connect connects to the MySQL database at dsn, as returned by DSN, with
+// pool, exiting when it can't be reached.
+func Connect(dsn string, pool Pool) *sql.DB {
+	mysqlConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		log.Fatalf("invalid data source name: %s\n", err)
+	}
+
+	// Every query is traced as a child of the span in its context.
+	db, err := otelsql.Open("mysql", dsn,
+		otelsql.WithAttributes(semconv.DBSystemMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
 	)
-	db, err := sql.Open("mysql", addr)
 	if err != nil {
 		log.Fatalf("connection failed: %s\n", err)
 	}
@@ -28,15 +43,28 @@ func Connect() *sql.DB {
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Printf("connected to mysql database %q\n", dbName)
+	slog.Info("connected to mysql database", "database", mysqlConfig.DBName)
 
-	db.SetConnMaxLifetime(time.Minute * 3)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
 
 	return db
 }
 
+// DSN returns the data source name of the database name on the MySQL server
+// at host and port, escaping the credentials as needed.
+func DSN(user, password, host, port, name string) string {
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.User = user
+	mysqlConfig.Passwd = password
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(host, port)
+	mysqlConfig.DBName = name
+
+	return mysqlConfig.FormatDSN()
+}
+
 func Disconnect(db *sql.DB) {
 	if err := db.Close(); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// migrations are the schema migrations the server was built with.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// ErrNoMigrations is returned by MigrationVersion when no migration has been
+// run on the database.
+var ErrNoMigrations = errors.New("no migrations have been run")
+
+// ExpectedMigration returns the version of the newest migration the server
+// was built with, the version the database schema is expected to be at.
+func ExpectedMigration() (uint, error) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			continue
+		}
+
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		latest = max(latest, uint(version))
+	}
+
+	return latest, nil
+}
+
+// MigrationVersion returns the version of the last migration run on db, as
+// recorded by golang-migrate, and whether it failed halfway, leaving the
+// schema dirty.
+func MigrationVersion(ctx context.Context, db *sql.DB) (version uint, dirty bool, err error) {
+	row := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	err = row.Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, ErrNoMigrations
+	}
+
+	return version, dirty, err
+}
@@ -0,0 +1,7 @@
+DROP INDEX idx_locations_deleted_at ON locations;
+DROP INDEX idx_users_deleted_at ON users;
+DROP INDEX idx_events_deleted_at ON events;
+
+ALTER TABLE locations DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE events DROP COLUMN deleted_at;
@@ -0,0 +1,7 @@
+ALTER TABLE events ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE locations ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+
+CREATE INDEX idx_events_deleted_at ON events (deleted_at);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX idx_locations_deleted_at ON locations (deleted_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS event_revisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    event_id INT NOT NULL,
+    revision INT NOT NULL,
+    snapshot JSON NOT NULL,
+    created_by INT,
+    rolled_back_from INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, revision),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
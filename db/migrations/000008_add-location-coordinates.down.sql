@@ -0,0 +1,3 @@
+ALTER TABLE locations
+    DROP COLUMN longitude,
+    DROP COLUMN latitude;
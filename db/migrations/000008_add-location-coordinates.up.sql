@@ -0,0 +1,3 @@
+ALTER TABLE locations
+    ADD COLUMN latitude DECIMAL(9, 6) NULL DEFAULT NULL,
+    ADD COLUMN longitude DECIMAL(9, 6) NULL DEFAULT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX idx_locations_coordinates ON locations;
+
+ALTER TABLE locations DROP COLUMN coordinates;
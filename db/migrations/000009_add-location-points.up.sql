@@ -0,0 +1,11 @@
+-- Spatial indexes can't be built on nullable columns, so locations without
+-- coordinates are stored at POINT(0 0) and told apart by latitude IS NULL.
+ALTER TABLE locations
+    ADD COLUMN coordinates POINT SRID 4326 NOT NULL
+    DEFAULT (ST_PointFromText('POINT(0 0)', 4326, 'axis-order=long-lat'));
+
+UPDATE locations
+SET coordinates = ST_PointFromText(CONCAT('POINT(', longitude, ' ', latitude, ')'), 4326, 'axis-order=long-lat')
+WHERE latitude IS NOT NULL AND longitude IS NOT NULL;
+
+CREATE SPATIAL INDEX idx_locations_coordinates ON locations (coordinates);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS event_registrations;
+
+ALTER TABLE events
+    DROP COLUMN online_access_instructions,
+    DROP COLUMN online_platform,
+    DROP COLUMN online_url,
+    DROP COLUMN attendance_mode;
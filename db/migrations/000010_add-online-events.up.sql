@@ -0,0 +1,14 @@
+ALTER TABLE events
+    ADD COLUMN attendance_mode ENUM('in_person', 'online', 'hybrid') NOT NULL DEFAULT 'in_person',
+    ADD COLUMN online_url VARCHAR(255),
+    ADD COLUMN online_platform VARCHAR(50),
+    ADD COLUMN online_access_instructions VARCHAR(1500);
+
+CREATE TABLE IF NOT EXISTS event_registrations (
+    event_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
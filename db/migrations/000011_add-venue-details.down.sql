@@ -0,0 +1,8 @@
+ALTER TABLE locations
+    DROP COLUMN transit_notes,
+    DROP COLUMN parking_notes,
+    DROP COLUMN capacity,
+    DROP COLUMN asl_available,
+    DROP COLUMN accessible_restroom,
+    DROP COLUMN elevator,
+    DROP COLUMN step_free_access;
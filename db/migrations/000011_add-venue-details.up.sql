@@ -0,0 +1,9 @@
+-- Accessibility features are NULL when unknown.
+ALTER TABLE locations
+    ADD COLUMN step_free_access TINYINT(1) NULL DEFAULT NULL,
+    ADD COLUMN elevator TINYINT(1) NULL DEFAULT NULL,
+    ADD COLUMN accessible_restroom TINYINT(1) NULL DEFAULT NULL,
+    ADD COLUMN asl_available TINYINT(1) NULL DEFAULT NULL,
+    ADD COLUMN capacity INT NULL DEFAULT NULL,
+    ADD COLUMN parking_notes VARCHAR(500) NULL DEFAULT NULL,
+    ADD COLUMN transit_notes VARCHAR(500) NULL DEFAULT NULL;
@@ -0,0 +1,11 @@
+ALTER TABLE organizations
+    DROP FOREIGN KEY fk_organizations_logo_image;
+
+ALTER TABLE organizations
+    DROP COLUMN updated_at,
+    DROP COLUMN created_at,
+    DROP COLUMN social_links,
+    DROP COLUMN contact_email,
+    DROP COLUMN logo_image_id,
+    DROP COLUMN website,
+    DROP COLUMN description;
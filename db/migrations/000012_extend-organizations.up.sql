@@ -0,0 +1,9 @@
+ALTER TABLE organizations
+    ADD COLUMN description VARCHAR(1500),
+    ADD COLUMN website VARCHAR(255),
+    ADD COLUMN logo_image_id INT,
+    ADD COLUMN contact_email VARCHAR(100),
+    ADD COLUMN social_links JSON,
+    ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    ADD CONSTRAINT fk_organizations_logo_image FOREIGN KEY (logo_image_id) REFERENCES images(id);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role ENUM('owner', 'manager', 'viewer') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id),
+    INDEX idx_organization_members_user (user_id),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Only a SHA-256 hash of the invitation token is stored, the token itself is
+-- only ever sent to the invited email address.
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    organization_id INT NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    role ENUM('owner', 'manager', 'viewer') NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    accepted_by INT,
+    INDEX idx_organization_invitations_org (organization_id),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS event_organizations (
+    event_id INT NOT NULL,
+    organization_id INT NOT NULL,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Only set for the primary host, so that an event has at most one.
+    primary_event_id INT AS (IF(is_primary, event_id, NULL)) STORED UNIQUE,
+    PRIMARY KEY (event_id, organization_id),
+    INDEX idx_event_organizations_org (organization_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
+
+-- events.organization_id is kept as the primary host.
+INSERT INTO event_organizations (event_id, organization_id, is_primary)
+SELECT id, organization_id, TRUE FROM events WHERE organization_id IS NOT NULL;
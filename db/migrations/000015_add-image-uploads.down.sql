@@ -0,0 +1,10 @@
+ALTER TABLE images
+    DROP FOREIGN KEY fk_images_uploaded_by;
+
+ALTER TABLE images
+    DROP COLUMN uploaded_by,
+    DROP COLUMN height,
+    DROP COLUMN width,
+    DROP COLUMN size_bytes,
+    DROP COLUMN content_type,
+    DROP COLUMN storage_key;
@@ -0,0 +1,8 @@
+ALTER TABLE images
+    ADD COLUMN storage_key VARCHAR(255) UNIQUE,
+    ADD COLUMN content_type VARCHAR(50),
+    ADD COLUMN size_bytes INT,
+    ADD COLUMN width INT,
+    ADD COLUMN height INT,
+    ADD COLUMN uploaded_by INT,
+    ADD CONSTRAINT fk_images_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE SET NULL;
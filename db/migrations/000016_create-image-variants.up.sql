@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS image_variants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    image_id INT NOT NULL,
+    name VARCHAR(20) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size_bytes INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    url VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (image_id, name, content_type),
+    FOREIGN KEY (image_id) REFERENCES images(id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    DROP FOREIGN KEY fk_users_avatar_image;
+
+ALTER TABLE users
+    DROP COLUMN avatar_image_id,
+    ADD COLUMN profile_picture VARCHAR(255);
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN avatar_image_id INT,
+    ADD CONSTRAINT fk_users_avatar_image FOREIGN KEY (avatar_image_id) REFERENCES images(id) ON DELETE SET NULL,
+    DROP COLUMN profile_picture;
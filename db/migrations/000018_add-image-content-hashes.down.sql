@@ -0,0 +1,10 @@
+-- Fails if identical uploads are sharing files.
+ALTER TABLE image_variants
+    DROP INDEX idx_image_variants_storage_key,
+    ADD UNIQUE INDEX storage_key (storage_key);
+
+ALTER TABLE images
+    DROP INDEX idx_images_storage_key,
+    ADD UNIQUE INDEX storage_key (storage_key),
+    DROP INDEX idx_images_content_hash,
+    DROP COLUMN content_hash;
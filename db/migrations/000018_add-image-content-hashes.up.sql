@@ -0,0 +1,10 @@
+-- Identical uploads share their files, so storage keys are no longer unique.
+ALTER TABLE images
+    ADD COLUMN content_hash CHAR(64),
+    ADD INDEX idx_images_content_hash (content_hash),
+    DROP INDEX storage_key,
+    ADD INDEX idx_images_storage_key (storage_key);
+
+ALTER TABLE image_variants
+    DROP INDEX storage_key,
+    ADD INDEX idx_image_variants_storage_key (storage_key);
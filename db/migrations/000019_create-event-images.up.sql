@@ -0,0 +1,20 @@
+-- Photo galleries of events. Photos submitted by members who don't manage the
+-- event stay pending until an editor approves them.
+CREATE TABLE IF NOT EXISTS event_images (
+    event_id INT NOT NULL,
+    image_id INT NOT NULL,
+    position INT NOT NULL,
+    caption VARCHAR(500),
+    photographer VARCHAR(100),
+    alt VARCHAR(150) NOT NULL,
+    status ENUM('pending', 'approved') NOT NULL DEFAULT 'pending',
+    submitted_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, image_id),
+    INDEX idx_event_images_position (event_id, status, position),
+    INDEX idx_event_images_image (image_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (image_id) REFERENCES images(id),
+    FOREIGN KEY (submitted_by) REFERENCES users(id) ON DELETE SET NULL
+);
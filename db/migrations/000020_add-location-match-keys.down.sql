@@ -0,0 +1,6 @@
+DROP INDEX idx_locations_address_key ON locations;
+DROP INDEX idx_locations_name_key ON locations;
+
+ALTER TABLE locations
+    DROP COLUMN address_key,
+    DROP COLUMN name_key;
@@ -0,0 +1,14 @@
+-- Normalized names and addresses, as compared when looking for duplicate
+-- locations, so that candidates can be narrowed down by prefix. Locations
+-- saved from now on get the keys normalized by the application; existing ones
+-- are approximated here, without address abbreviations.
+ALTER TABLE locations
+    ADD COLUMN name_key VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN address_key VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE locations
+SET name_key = TRIM(REGEXP_REPLACE(LOWER(name), '[^[:alnum:]]+', ' ')),
+    address_key = TRIM(REGEXP_REPLACE(LOWER(address), '[^[:alnum:]]+', ' '));
+
+CREATE INDEX idx_locations_name_key ON locations (name_key);
+CREATE INDEX idx_locations_address_key ON locations (address_key);
@@ -0,0 +1 @@
+ALTER TABLE locations ADD COLUMN version INT NOT NULL DEFAULT 1;
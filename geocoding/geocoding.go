@@ -0,0 +1,37 @@
+// Package geocoding turns free-text addresses into coordinates.
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+var ErrNoResults = errors.New("address could not be geocoded")
+
+// Result is the best match for a geocoded address.
+type Result struct {
+	Latitude  float64
+	Longitude float64
+	// Address is the normalized form of the address that was looked up.
+	Address string
+}
+
+// Geocoder looks up the coordinates of an address. ErrNoResults is returned
+// when the address can't be found.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (*Result, error)
+}
+
+// MapURL returns an OpenStreetMap link centered on the given coordinates.
+func MapURL(lat, lon float64) string {
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=17/%.6f/%.6f",
+		lat, lon, lat, lon)
+}
+
+// SearchURL returns an OpenStreetMap link searching for address, for when its
+// coordinates aren't known.
+func SearchURL(address string) string {
+	return "https://www.openstreetmap.org/search?query=" + url.QueryEscape(address)
+}
@@ -0,0 +1,128 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nominatim geocodes addresses using a Nominatim compatible search API, such as
+// https://nominatim.openstreetmap.org.
+type Nominatim struct {
+	BaseURL string
+	// UserAgent identifies the application, as required by the usage policy
+	// of the public Nominatim instance.
+	UserAgent string
+	Client    *http.Client
+}
+
+// NewNominatim returns a Nominatim geocoder using the API at baseURL.
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+	return &Nominatim{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		UserAgent: userAgent,
+		Client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type nominatimPlace struct {
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	Address     struct {
+		HouseNumber string `json:"house_number"`
+		Road        string `json:"road"`
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		State       string `json:"state"`
+		Postcode    string `json:"postcode"`
+	} `json:"address"`
+}
+
+// Geocode looks up address and returns the best match.
+func (n *Nominatim) Geocode(ctx context.Context, address string) (*Result, error) {
+	params := url.Values{
+		"q":              {address},
+		"format":         {"jsonv2"},
+		"addressdetails": {"1"},
+		"limit":          {"1"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.BaseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", n.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim returned %s", res.Status)
+	}
+
+	var places []nominatimPlace
+	if err := json.NewDecoder(res.Body).Decode(&places); err != nil {
+		return nil, fmt.Errorf("failed to decode nominatim response: %w", err)
+	}
+
+	if len(places) == 0 {
+		return nil, ErrNoResults
+	}
+	place := places[0]
+
+	lat, err := strconv.ParseFloat(place.Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("nominatim returned invalid latitude %q", place.Lat)
+	}
+
+	lon, err := strconv.ParseFloat(place.Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("nominatim returned invalid longitude %q", place.Lon)
+	}
+
+	return &Result{
+		Latitude:  lat,
+		Longitude: lon,
+		Address:   place.normalizedAddress(),
+	}, nil
+}
+
+// normalizedAddress formats the place's address as
+// "123 Main St, City, State 12345", falling back to the display name when the
+// street or city is missing.
+func (p nominatimPlace) normalizedAddress() string {
+	addr := p.Address
+
+	city := addr.City
+	if city == "" {
+		city = addr.Town
+	}
+	if city == "" {
+		city = addr.Village
+	}
+
+	if addr.Road == "" || city == "" {
+		return p.DisplayName
+	}
+
+	street := strings.TrimSpace(addr.HouseNumber + " " + addr.Road)
+	region := strings.TrimSpace(addr.State + " " + addr.Postcode)
+
+	parts := []string{street, city}
+	if region != "" {
+		parts = append(parts, region)
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,22 @@
+package geocoding
+
+import (
+	"context"
+	"strings"
+)
+
+// Static geocodes addresses from a fixed set of results, keyed by address. It
+// stands in for a real geocoder in tests and local development. Addresses are
+// matched case-insensitively and ignoring surrounding whitespace.
+type Static map[string]Result
+
+// Geocode returns the result for address, or ErrNoResults if there is none.
+func (s Static) Geocode(_ context.Context, address string) (*Result, error) {
+	for key, result := range s {
+		if strings.EqualFold(strings.TrimSpace(key), strings.TrimSpace(address)) {
+			return &result, nil
+		}
+	}
+
+	return nil, ErrNoResults
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+// audit records a change made by the request in the audit log. before and
+// after are the resource before and after the change, either may be nil.
+//
+// The change has already been made by the time it is audited, so a failure
+// to record it is logged instead of failing the request.
+func (s *Server) audit(r *http.Request, action, resourceType string, resourceId int, before, after any) {
+	changes, err := models.Diff(before, after)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to diff for audit log",
+			"error", err, "resource_type", resourceType, "resource_id", resourceId)
+		return
+	}
+
+	entry := models.AuditEntry{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceId:   &resourceId,
+		Changes:      changes,
+		ActorId:      currentUserId(r),
+	}
+
+	if ip := s.clientIP(r); ip != "" {
+		entry.IP = &ip
+	}
+
+	if requestId := logging.RequestId(r.Context()); requestId != "" {
+		entry.RequestId = &requestId
+	}
+
+	// The request context may already be canceled if the client went away,
+	// but the change still has to be recorded.
+	ctx := context.WithoutCancel(r.Context())
+	if err := models.InsertAuditEntry(ctx, s.db, entry); err != nil {
+		logging.FromContext(ctx).Error("failed to audit",
+			"error", err, "action", action, "resource_type", resourceType, "resource_id", resourceId)
+	}
+}
+
+// clientIP returns the address of the client making the request. Clients can
+// write anything in X-Forwarded-For, so it is only read when the request
+// comes from a trusted proxy. Each proxy appends the address it got the
+// request from, the client's is then the rightmost one that isn't a trusted
+// proxy's.
+func (s *Server) clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0 && s.trustedProxy(ip); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// A malformed hop wasn't written by a trusted proxy, the last
+			// address known is the best there is.
+			break
+		}
+		ip = hop
+	}
+
+	return ip
+}
+
+// trustedProxy reports whether ip is the address of a trusted proxy.
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, proxy := range s.TrustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ListAuditEntries lists audit log entries, newest first. Entries can be
+// filtered with the actor_id, action, resource_type, resource_id, since and
+// until query parameters and paged through with limit and before_id.
+func (s *Server) ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		Limit:        50,
+	}
+
+	var err error
+	filter.ActorId, err = optionalIntParam(r, "actor_id")
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filter.ResourceId, err = optionalIntParam(r, "resource_id")
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filter.Since, err = optionalTimeParam(r, "since")
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filter.Until, err = optionalTimeParam(r, "until")
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if val := query.Get("before_id"); val != "" {
+		filter.BeforeId, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			responses.Error(w, http.StatusBadRequest, errors.New("before_id must be an integer"))
+			return
+		}
+	}
+
+	if val := query.Get("limit"); val != "" {
+		filter.Limit, err = strconv.Atoi(val)
+		if err != nil || filter.Limit < 1 || filter.Limit > 500 {
+			responses.Error(w, http.StatusBadRequest, errors.New("limit must be an integer between 1 and 500"))
+			return
+		}
+	}
+
+	entries, err := models.FindAuditEntries(r.Context(), s.db, filter)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, entries)
+}
+
+// optionalIntParam parses the query parameter name as an integer. nil is
+// returned when the parameter isn't set.
+func optionalIntParam(r *http.Request, name string) (*int, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+
+	return &n, nil
+}
+
+// optionalTimeParam parses the query parameter name as an RFC 3339 timestamp.
+// nil is returned when the parameter isn't set.
+func optionalTimeParam(r *http.Request, name string) (*time.Time, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+
+	return &t, nil
+}
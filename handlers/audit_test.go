@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	s := &Server{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "203.0.113.7:51234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "forwarded by an untrusted client",
+			remoteAddr: "203.0.113.7:51234",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "through a trusted proxy",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed entry before the trusted proxy's",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"198.51.100.1, 203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "through a chain of trusted proxies",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"198.51.100.1, 203.0.113.7", "192.0.2.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "only trusted proxies",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"10.9.9.9"},
+			want:       "10.9.9.9",
+		},
+		{
+			name:       "malformed entry",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"not an address"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "IPv4 mapped trusted proxy",
+			remoteAddr: "[::ffff:10.1.2.3]:51234",
+			forwarded:  []string{"2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, forwarded := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+
+			if got := s.clientIP(r); got != test.want {
+				t.Errorf("clientIP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+// userIdHeader carries the id of the user making a request.
+//
+// TODO: replace with real authentication. Until then the header is trusted
+// as-is, so it must only ever be set by the proxy in front of the server.
+const userIdHeader = "X-User-Id"
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+var (
+	errInvalidUserHeader     = errors.New(userIdHeader + " must be the id of an existing user")
+	errNotAuthenticated      = errors.New("authentication required")
+	errNotAdmin              = errors.New("administrator role required")
+	errNotEditor             = errors.New("editor or administrator role required")
+	errNotEventManager       = errors.New("events can only be managed by editors or by managers of their organization")
+	errNotOrganizationRole   = errors.New("you don't have the organization role required")
+	errInvalidIncludeDeleted = errors.New("include_deleted must be a boolean")
+)
+
+// UserMiddleware loads the user making the request, if any, into the request
+// context. Requests without a user are passed on anonymously.
+func (s *Server) UserMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.Header.Get(userIdHeader)
+		if idStr == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userId, err := strconv.Atoi(idStr)
+		if err != nil {
+			responses.Error(w, http.StatusUnauthorized, errInvalidUserHeader)
+			return
+		}
+
+		user, err := models.FindUserByID(r.Context(), s.db, userId, false)
+		if errors.Is(err, models.ErrUserNotFound) {
+			responses.Error(w, http.StatusUnauthorized, errInvalidUserHeader)
+			return
+		}
+		if err != nil {
+			responses.Error(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		setAccessLogUser(r, user.ID)
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", user.ID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// currentUser returns the user making the request or nil for anonymous
+// requests.
+func currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// currentUserId returns the id of the user making the request or nil for
+// anonymous requests.
+func currentUserId(r *http.Request) *int {
+	if user := currentUser(r); user != nil {
+		return &user.ID
+	}
+
+	return nil
+}
+
+// requireAdmin writes an error response and returns false unless the request
+// was made by an administrator.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return false
+	}
+
+	if !user.IsAdmin() {
+		responses.Error(w, http.StatusForbidden, errNotAdmin)
+		return false
+	}
+
+	return true
+}
+
+// requireEditor writes an error response and returns false unless the request
+// was made by an editor or an administrator.
+func requireEditor(w http.ResponseWriter, r *http.Request) bool {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return false
+	}
+
+	if !user.IsEditor() {
+		responses.Error(w, http.StatusForbidden, errNotEditor)
+		return false
+	}
+
+	return true
+}
+
+// requireOrganizationRole writes an error response and returns false unless
+// the request was made by an editor or by a member of the organization orgId
+// with one of roles.
+func (s *Server) requireOrganizationRole(w http.ResponseWriter, r *http.Request, orgId int, roles ...string) bool {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return false
+	}
+
+	if user.IsEditor() {
+		return true
+	}
+
+	orgRoles, err := models.FindOrganizationRoles(r.Context(), s.db, user.ID, []int{orgId})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if !slices.Contains(roles, orgRoles[orgId]) {
+		responses.Error(w, http.StatusForbidden, errNotOrganizationRole)
+		return false
+	}
+
+	return true
+}
+
+// requireEventManager writes an error response and returns false unless the
+// request was made by a user who can manage the events of every organization
+// in orgIds. Editors manage all events, while owners and managers of an
+// organization only manage its events. Events without an organization, a nil
+// id, can only be managed by editors.
+func (s *Server) requireEventManager(w http.ResponseWriter, r *http.Request, orgIds ...*int) bool {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return false
+	}
+
+	if user.IsEditor() {
+		return true
+	}
+
+	ids := []int{}
+	for _, id := range orgIds {
+		if id == nil {
+			responses.Error(w, http.StatusForbidden, errNotEventManager)
+			return false
+		}
+		ids = append(ids, *id)
+	}
+
+	roles, err := models.FindOrganizationRoles(r.Context(), s.db, user.ID, ids)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	for _, id := range ids {
+		if !models.CanManageEvents(roles[id]) {
+			responses.Error(w, http.StatusForbidden, errNotEventManager)
+			return false
+		}
+	}
+
+	return true
+}
+
+// hostIds returns the ids of the organizations hosting event, primary host
+// first.
+func hostIds(event *models.Event) []int {
+	if len(event.OrganizationIds) > 0 {
+		return event.OrganizationIds
+	}
+
+	if event.OrganizationId != nil {
+		return []int{*event.OrganizationId}
+	}
+
+	return []int{}
+}
+
+// managesAnyHost reports whether a user with roles, their roles by
+// organization id, is an owner or manager of one of the organizations hosting
+// event. Co-hosts share the event's gallery and online access details with the
+// primary host, though only the primary host's managers can change the event
+// itself.
+func managesAnyHost(event *models.Event, roles map[int]string) bool {
+	for _, id := range hostIds(event) {
+		if models.CanManageEvents(roles[id]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireSelfOrAdmin writes an error response and returns false unless the
+// request was made by the user userId or by an administrator.
+func requireSelfOrAdmin(w http.ResponseWriter, r *http.Request, userId int) bool {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return false
+	}
+
+	if user.ID != userId && !user.IsAdmin() {
+		responses.Error(w, http.StatusForbidden, errNotSelfOrAdmin)
+		return false
+	}
+
+	return true
+}
+
+// includeDeleted reports whether soft-deleted rows were requested with
+// ?include_deleted=true. It writes an error response and returns ok=false when
+// the parameter is malformed or the user isn't an administrator.
+func includeDeleted(w http.ResponseWriter, r *http.Request) (include bool, ok bool) {
+	val := r.URL.Query().Get("include_deleted")
+	if val == "" {
+		return false, true
+	}
+
+	include, err := strconv.ParseBool(val)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errInvalidIncludeDeleted)
+		return false, false
+	}
+
+	if include && !requireAdmin(w, r) {
+		return false, false
+	}
+
+	return include, true
+}
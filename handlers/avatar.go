@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/imaging"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+var errNotSelfOrAdmin = errors.New("only the user themselves or an administrator can do this")
+
+// GetUserAvatar redirects to the avatar a user uploaded, or responds with a
+// generated avatar showing their initials.
+func (s *Server) GetUserAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.New("user ID must be an integer value"))
+		return
+	}
+
+	user, err := models.FindUserByID(r.Context(), s.db, userID, false)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	if err := s.prepareUsers(r, user); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if user.Avatar != nil {
+		http.Redirect(w, r, user.AvatarUrl, http.StatusFound)
+		return
+	}
+
+	svg := imaging.InitialsSVG(imaging.Initials(user.FirstName, user.LastName, user.Username), user.ID)
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.WriteHeader(http.StatusOK)
+	w.Write(svg) //nolint:errcheck // nothing to do if the client went away
+}
+
+// PutUserAvatar replaces a user's avatar with an image uploaded as the
+// "image" field of a multipart form. The image is cropped to a square. Only
+// the user themselves or an administrator can change an avatar.
+func (s *Server) PutUserAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.New("user ID must be an integer value"))
+		return
+	}
+
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+
+	if s.Storage == nil {
+		responses.Error(w, http.StatusServiceUnavailable, errStorageUnavailable)
+		return
+	}
+
+	before, err := models.FindUserByID(r.Context(), s.db, userID, false)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	data, filename, status, err := readImageUpload(w, r)
+	if err != nil {
+		responses.Error(w, status, err)
+		return
+	}
+
+	alt := r.FormValue("alt")
+	if alt == "" {
+		alt = fmt.Sprintf("Avatar of %s", before.Username)
+	}
+
+	img, status, err := s.storeImage(r, data, filename, alt, avatarImage)
+	if err != nil {
+		responses.Error(w, status, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionCreate, models.AuditResourceImage, img.Id, nil, img)
+	s.Metrics.ImagesUploaded.Inc()
+
+	s.setUserAvatar(w, r, before, &img.Id)
+}
+
+// DeleteUserAvatar removes a user's avatar, going back to a generated one.
+// Only the user themselves or an administrator can remove an avatar.
+func (s *Server) DeleteUserAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.New("user ID must be an integer value"))
+		return
+	}
+
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+
+	before, err := models.FindUserByID(r.Context(), s.db, userID, false)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	s.setUserAvatar(w, r, before, nil)
+}
+
+// setUserAvatar sets the avatar of the user before to the image imageId and
+// responds with the updated user.
+func (s *Server) setUserAvatar(w http.ResponseWriter, r *http.Request, before *models.User, imageId *int) {
+	err := models.SetUserAvatar(r.Context(), s.db, before.ID, imageId)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to update user"))
+		return
+	}
+
+	after, err := models.FindUserByID(r.Context(), s.db, before.ID, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceUser, before.ID, before, after)
+
+	if err := s.prepareUsers(r, after); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, after.Version)
+	responses.Json(w, http.StatusOK, after)
+}
+
+// prepareUsers fills in the avatar of users for a response.
+func (s *Server) prepareUsers(r *http.Request, users ...*models.User) error {
+	imageIds := []int{}
+	for _, user := range users {
+		if user.AvatarImageId != nil {
+			imageIds = append(imageIds, *user.AvatarImageId)
+		}
+	}
+
+	sources, err := models.FindImageSources(r.Context(), s.db, imageIds)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		user.AvatarUrl = fmt.Sprintf("/users/%d/avatar", user.ID)
+		if user.AvatarImageId == nil {
+			continue
+		}
+
+		user.Avatar = sources[*user.AvatarImageId]
+		if user.Avatar != nil {
+			user.AvatarUrl = user.Avatar.Url
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/somos831/somos-backend/responses"
+)
+
+var (
+	errIfMatchRequired = errors.New("If-Match header with the resource's ETag is required")
+	errInvalidIfMatch  = errors.New("If-Match header must be a single ETag")
+	errStaleETag       = errors.New("resource was modified since it was fetched, fetch it again and retry")
+)
+
+// setETag sets the ETag header to the resource's version.
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion parses the If-Match header into the resource version the
+// client based its change on. current is used when the header is "*".
+//
+// It writes an error response and returns ok=false when the header is missing
+// or isn't a version.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, current int) (version int, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		responses.Error(w, http.StatusPreconditionRequired, errIfMatchRequired)
+		return 0, false
+	}
+
+	if header == "*" {
+		return current, true
+	}
+
+	// Weak ETags never match If-Match.
+	if strings.HasPrefix(header, "W/") {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return 0, false
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errInvalidIfMatch)
+		return 0, false
+	}
+
+	version, err = strconv.Atoi(tag)
+	if err != nil {
+		// Not one of our ETags, so it can't match.
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return 0, false
+	}
+
+	return version, true
+}
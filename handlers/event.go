@@ -3,16 +3,31 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/somos831/somos-backend/models"
 	"github.com/somos831/somos-backend/responses"
 )
 
-var errNonNumericEventId = errors.New("event id must be an integer")
+var (
+	errNonNumericEventId = errors.New("event id must be an integer")
+	errInvalidNear       = errors.New("near must be a latitude and longitude, such as near=36.6,-121.9")
+	errInvalidRadius     = errors.New("radius_km must be a number greater than 0 and at most 500")
+)
 
+// ListEvents lists the most recent events. With ?near=lat,lon it lists the
+// events within radius_km (25 by default) of that point instead, nearest
+// first, along with their distance.
+//
+// Events can be limited to accessible venues with step_free_access, elevator,
+// accessible_restroom and asl_available set to true, and to venues holding at
+// least min_capacity people.
 func (s *Server) ListEvents(w http.ResponseWriter, r *http.Request) {
 	nStr := r.URL.Query().Get("limit")
 	limit := 15
@@ -29,8 +44,42 @@ func (s *Server) ListEvents(w http.ResponseWriter, r *http.Request) {
 		limit = n
 	}
 
-	events, err := models.FindNRecentEvents(r.Context(), s.db, limit)
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	filter := models.EventFilter{
+		Limit:          limit,
+		IncludeDeleted: withDeleted,
+	}
+
+	near, radiusKm, err := parseNear(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.Near = near
+	filter.RadiusKm = radiusKm
+
+	err = parseVenueFilter(r, &filter)
 	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, err := models.FindEvents(r.Context(), s.db, filter)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	eventPtrs := make([]*models.Event, len(events))
+	for i := range events {
+		eventPtrs[i] = &events[i]
+	}
+
+	if err := s.prepareEvents(r, eventPtrs...); err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -38,6 +87,89 @@ func (s *Server) ListEvents(w http.ResponseWriter, r *http.Request) {
 	responses.Json(w, http.StatusOK, events)
 }
 
+// parseNear parses the near=lat,lon and radius_km query parameters. A nil
+// point is returned when near isn't set.
+func parseNear(r *http.Request) (*models.GeoPoint, float64, error) {
+	nearStr := r.URL.Query().Get("near")
+	if nearStr == "" {
+		return nil, 0, nil
+	}
+
+	latStr, lonStr, found := strings.Cut(nearStr, ",")
+	if !found {
+		return nil, 0, errInvalidNear
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, 0, errInvalidNear
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return nil, 0, errInvalidNear
+	}
+
+	radiusKm := 25.0
+	if radiusStr := r.URL.Query().Get("radius_km"); radiusStr != "" {
+		radiusKm, err = strconv.ParseFloat(radiusStr, 64)
+		if err != nil || radiusKm <= 0 || radiusKm > 500 {
+			return nil, 0, errInvalidRadius
+		}
+	}
+
+	return &models.GeoPoint{Latitude: lat, Longitude: lon}, radiusKm, nil
+}
+
+// parseVenueFilter parses the venue accessibility and capacity query
+// parameters into filter.
+func parseVenueFilter(r *http.Request, filter *models.EventFilter) error {
+	query := r.URL.Query()
+
+	features := map[string]**bool{
+		"step_free_access":    &filter.Venue.StepFreeAccess,
+		"elevator":            &filter.Venue.Elevator,
+		"accessible_restroom": &filter.Venue.AccessibleRestroom,
+		"asl_available":       &filter.Venue.AslAvailable,
+	}
+	for name, feature := range features {
+		val := query.Get(name)
+		if val == "" {
+			continue
+		}
+
+		required, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%s must be a boolean", name)
+		}
+		*feature = &required
+	}
+
+	if val := query.Get("min_capacity"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return errors.New("min_capacity must be a positive integer")
+		}
+		filter.MinCapacity = n
+	}
+
+	return nil
+}
+
+// prepareEvents fills in the venue and image of events for a response and
+// hides the details the user making the request isn't allowed to see.
+func (s *Server) prepareEvents(r *http.Request, events ...*models.Event) error {
+	if err := models.AttachLocations(r.Context(), s.db, events...); err != nil {
+		return err
+	}
+
+	if err := models.AttachImages(r.Context(), s.db, events...); err != nil {
+		return err
+	}
+
+	return s.hideOnlineAccess(r, events...)
+}
+
 // GetEvent returns a single event by its id.
 func (s *Server) GetEvent(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -51,16 +183,29 @@ func (s *Server) GetEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event, err := models.FindEventById(r.Context(), s.db, eventId)
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := models.FindEventById(r.Context(), s.db, eventId, withDeleted)
 	if err != nil {
 		responses.Error(w, http.StatusNotFound, err)
 		return
 	}
 
+	if err := s.prepareEvents(r, event); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, event.Version)
 	responses.Json(w, http.StatusOK, event)
 }
 
-// CreateEvent creates a new event using the form data.
+// CreateEvent creates a new event using the form data. Only editors and the
+// owners and managers of every organization hosting the event can create
+// events.
 func (s *Server) CreateEvent(w http.ResponseWriter, r *http.Request) {
 	var newEvent models.Event
 	err := json.NewDecoder(r.Body).Decode(&newEvent)
@@ -69,25 +214,43 @@ func (s *Server) CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	newEvent.NormalizeHosts()
+
+	hosts := append([]*int{newEvent.OrganizationId}, addedHosts(nil, newEvent.OrganizationIds)...)
+	if !s.requireEventManager(w, r, hosts...) {
+		return
+	}
+
+	if newEvent.AttendanceMode == "" {
+		newEvent.AttendanceMode = models.AttendanceInPerson
+	}
+
 	err = s.Validator.ValidateNewEvent(r.Context(), newEvent)
 	if err != nil {
 		responses.Error(w, http.StatusBadRequest, err)
 		return
 	}
 
-	eventId, err := models.InsertEvent(r.Context(), s.db, newEvent)
+	eventId, err := models.InsertEventWithRevision(r.Context(), s.db, newEvent, currentUserId(r))
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	newEvent.Id = eventId
+	s.audit(r, models.AuditActionCreate, models.AuditResourceEvent, eventId, nil, newEvent)
+	s.Metrics.EventsCreated.Inc()
+
 	res := map[string]int{
 		"event_id": eventId,
 	}
 	responses.Json(w, http.StatusCreated, res)
 }
 
-// UpdateEvent updates an event by its id.
+// UpdateEvent updates an event by its id. The body is a JSON merge patch
+// (RFC 7396): fields left out are kept and fields set to null are cleared.
+// Only editors and the owners and managers of the event's organization can
+// update events, and only add hosts they also manage.
 func (s *Server) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	eventIdStr := params["id"]
@@ -100,13 +263,50 @@ func (s *Server) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := models.FindEventById(r.Context(), s.db, eventId, false)
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !s.requireEventManager(w, r, before.OrganizationId) {
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, before.Version)
+	if !ok {
+		return
+	}
+
+	if !isMergePatch(r) {
+		responses.Error(w, http.StatusUnsupportedMediaType, errUnsupportedPatch)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Only the fields in the patch change, the rest keep their current value.
+	// Validation runs on the merged event below.
 	var event models.Event
-	err = json.NewDecoder(r.Body).Decode(&event)
+	err = applyMergePatch(before, patch, &event)
 	if err != nil {
-		responses.Error(w, http.StatusInternalServerError, err)
+		responses.Error(w, http.StatusBadRequest, err)
 		return
 	}
 	event.Id = eventId
+	event.Version = version
+	event.NormalizeHosts()
+
+	// Organization managers can't move events to an organization they don't
+	// manage, nor add hosts they don't manage.
+	hosts := append([]*int{event.OrganizationId}, addedHosts(before.OrganizationIds, event.OrganizationIds)...)
+	if !s.requireEventManager(w, r, hosts...) {
+		return
+	}
 
 	err = s.Validator.ValidateNewEvent(r.Context(), event)
 	if err != nil {
@@ -114,16 +314,33 @@ func (s *Server) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = models.UpdateEvent(r.Context(), s.db, &event)
+	after, err := models.UpdateEventWithRevision(r.Context(), s.db, &event, currentUserId(r))
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	responses.Json(w, http.StatusOK, event)
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceEvent, eventId, before, after)
+
+	if err := s.prepareEvents(r, after); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, after.Version)
+	responses.Json(w, http.StatusOK, after)
 }
 
-// DeleteEvent deletes an event by its id.
+// DeleteEvent deletes an event by its id. Only editors and the owners and
+// managers of the event's organization can delete events.
 func (s *Server) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	eventIdStr := params["id"]
@@ -136,11 +353,100 @@ func (s *Server) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = models.DeleteEvent(r.Context(), s.db, eventId)
+	before, err := models.FindEventById(r.Context(), s.db, eventId, false)
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !s.requireEventManager(w, r, before.OrganizationId) {
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, before.Version)
+	if !ok {
+		return
+	}
+
+	err = models.DeleteEvent(r.Context(), s.db, eventId, version)
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindEventById(r.Context(), s.db, eventId, true)
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	s.audit(r, models.AuditActionDelete, models.AuditResourceEvent, eventId, before, after)
+
 	responses.Json(w, http.StatusNoContent, nil)
 }
+
+// RestoreEvent restores a soft-deleted event by its id.
+func (s *Server) RestoreEvent(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	params := mux.Vars(r)
+	eventIdStr := params["id"]
+
+	eventId, err := strconv.Atoi(eventIdStr)
+	if err != nil {
+		err = errors.Join(errNonNumericEventId, err)
+		responses.Error(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	before, err := models.FindEventById(r.Context(), s.db, eventId, true)
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = models.RestoreEvent(r.Context(), s.db, eventId)
+	if errors.Is(err, models.ErrEventNotFound) {
+		responses.Error(w, http.StatusNotFound, errors.New("no deleted event with given id"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	event, err := models.FindEventById(r.Context(), s.db, eventId, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionRestore, models.AuditResourceEvent, eventId, before, event)
+
+	setETag(w, event.Version)
+	responses.Json(w, http.StatusOK, event)
+}
+
+// addedHosts returns the ids of the organizations in after that aren't in
+// before, as passed to requireEventManager.
+func addedHosts(before, after []int) []*int {
+	added := []*int{}
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			added = append(added, &id)
+		}
+	}
+
+	return added
+}
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+var (
+	errNonNumericGalleryImageId = errors.New("image id must be an integer")
+	errInvalidIncludePending    = errors.New("include_pending must be a boolean")
+	errNotImageUploader         = errors.New("only images you uploaded can be added to a gallery")
+	errPhotoSubmissionsDisabled = errors.New("only editors and the event's managers can add photos")
+	errNotGalleryImageOwner     = errors.New("photos can only be changed by editors, the event's managers or while pending by whoever submitted them")
+)
+
+// eventImageParams parses the event and image ids of gallery routes.
+func eventImageParams(r *http.Request) (eventId, imageId int, err error) {
+	params := mux.Vars(r)
+
+	eventId, err = strconv.Atoi(params["id"])
+	if err != nil {
+		return 0, 0, errNonNumericEventId
+	}
+
+	imageId, err = strconv.Atoi(params["image_id"])
+	if err != nil {
+		return 0, 0, errNonNumericGalleryImageId
+	}
+
+	return eventId, imageId, nil
+}
+
+// managesEvent reports whether the request was made by an editor or by an
+// owner or manager of one of the event's hosts, without writing a response.
+func (s *Server) managesEvent(r *http.Request, event *models.Event) (bool, error) {
+	user := currentUser(r)
+	if user == nil {
+		return false, nil
+	}
+
+	if user.IsEditor() {
+		return true, nil
+	}
+
+	roles, err := models.FindOrganizationRoles(r.Context(), s.db, user.ID, hostIds(event))
+	if err != nil {
+		return false, err
+	}
+
+	return managesAnyHost(event, roles), nil
+}
+
+// findGalleryEvent finds the event eventId and whether the request was made
+// by one of its managers. It writes an error response and returns ok=false
+// when the event can't be found.
+func (s *Server) findGalleryEvent(w http.ResponseWriter, r *http.Request, eventId int) (event *models.Event, manager bool, ok bool) {
+	event, err := models.FindEventById(r.Context(), s.db, eventId, false)
+	if errors.Is(err, models.ErrEventNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return nil, false, false
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return nil, false, false
+	}
+
+	manager, err = s.managesEvent(r, event)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return nil, false, false
+	}
+
+	return event, manager, true
+}
+
+// ListEventImages lists the photos in an event's gallery in order. Editors
+// and the event's managers can include pending photos with
+// ?include_pending=true.
+func (s *Server) ListEventImages(w http.ResponseWriter, r *http.Request) {
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.Join(errNonNumericEventId, err))
+		return
+	}
+
+	includePending := false
+	if value := r.URL.Query().Get("include_pending"); value != "" {
+		includePending, err = strconv.ParseBool(value)
+		if err != nil {
+			responses.Error(w, http.StatusBadRequest, errInvalidIncludePending)
+			return
+		}
+	}
+
+	_, manager, ok := s.findGalleryEvent(w, r, eventId)
+	if !ok {
+		return
+	}
+
+	if includePending && !manager {
+		if currentUser(r) == nil {
+			responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		} else {
+			responses.Error(w, http.StatusForbidden, errNotEventManager)
+		}
+		return
+	}
+
+	images, err := models.FindEventImages(r.Context(), s.db, eventId, includePending)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, images)
+}
+
+// AddEventImage adds an uploaded image to the end of an event's gallery.
+// Photos added by editors and the event's managers are public right away,
+// those submitted by other members, when photo submissions are enabled, wait
+// for an editor's approval. Only editors can add images uploaded by someone
+// else.
+func (s *Server) AddEventImage(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.Join(errNonNumericEventId, err))
+		return
+	}
+
+	_, manager, ok := s.findGalleryEvent(w, r, eventId)
+	if !ok {
+		return
+	}
+
+	if !manager && !s.PhotoSubmissions {
+		responses.Error(w, http.StatusForbidden, errPhotoSubmissionsDisabled)
+		return
+	}
+
+	var photo models.EventImage
+	err = json.NewDecoder(r.Body).Decode(&photo)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	img, err := models.FindImageById(r.Context(), s.db, photo.ImageId)
+	if errors.Is(err, models.ErrImageNotFound) {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !user.IsEditor() && (img.UploadedBy == nil || *img.UploadedBy != user.ID) {
+		responses.Error(w, http.StatusForbidden, errNotImageUploader)
+		return
+	}
+
+	photo.EventId = eventId
+	photo.SubmittedBy = &user.ID
+	photo.Status = models.EventImagePending
+	if manager {
+		photo.Status = models.EventImageApproved
+	}
+	if photo.Alt == "" {
+		photo.Alt = img.Alt
+	}
+
+	err = s.Validator.ValidateEventImage(photo)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = models.InsertEventImage(r.Context(), s.db, photo)
+	if errors.Is(err, models.ErrEventImageExists) || errors.Is(err, models.ErrEventGalleryFull) {
+		responses.Error(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := models.FindEventImage(r.Context(), s.db, eventId, photo.ImageId)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionCreate, models.AuditResourceEventImage, eventId, nil, created)
+
+	responses.Json(w, http.StatusCreated, created)
+}
+
+// UpdateEventImage changes the caption, photographer and alt text of a photo
+// in an event's gallery. Whoever submitted a photo can change it until it is
+// approved.
+func (s *Server) UpdateEventImage(w http.ResponseWriter, r *http.Request) {
+	eventId, imageId, err := eventImageParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	_, manager, ok := s.findGalleryEvent(w, r, eventId)
+	if !ok {
+		return
+	}
+
+	before, err := models.FindEventImage(r.Context(), s.db, eventId, imageId)
+	if errors.Is(err, models.ErrEventImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	submitter := before.SubmittedBy != nil && *before.SubmittedBy == user.ID
+	if !manager && !(submitter && before.Status == models.EventImagePending) {
+		responses.Error(w, http.StatusForbidden, errNotGalleryImageOwner)
+		return
+	}
+
+	var photo models.EventImage
+	err = json.NewDecoder(r.Body).Decode(&photo)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	photo.EventId = eventId
+	photo.ImageId = imageId
+
+	err = s.Validator.ValidateEventImage(photo)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = models.UpdateEventImage(r.Context(), s.db, photo)
+	if errors.Is(err, models.ErrEventImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindEventImage(r.Context(), s.db, eventId, imageId)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceEventImage, eventId, before, after)
+
+	responses.Json(w, http.StatusOK, after)
+}
+
+// ApproveEventImage makes a pending photo in an event's gallery public. Only
+// editors can approve photos.
+func (s *Server) ApproveEventImage(w http.ResponseWriter, r *http.Request) {
+	eventId, imageId, err := eventImageParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !requireEditor(w, r) {
+		return
+	}
+
+	before, err := models.FindEventImage(r.Context(), s.db, eventId, imageId)
+	if errors.Is(err, models.ErrEventImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = models.ApproveEventImage(r.Context(), s.db, eventId, imageId)
+	if errors.Is(err, models.ErrEventImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindEventImage(r.Context(), s.db, eventId, imageId)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceEventImage, eventId, before, after)
+
+	responses.Json(w, http.StatusOK, after)
+}
+
+// ReorderEventImages orders an event's gallery as the "image_ids" listed in
+// the request body, which must include every photo, pending ones too. Only
+// editors and the event's managers can reorder the gallery.
+func (s *Server) ReorderEventImages(w http.ResponseWriter, r *http.Request) {
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.Join(errNonNumericEventId, err))
+		return
+	}
+
+	if currentUser(r) == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	_, manager, ok := s.findGalleryEvent(w, r, eventId)
+	if !ok {
+		return
+	}
+
+	if !manager {
+		responses.Error(w, http.StatusForbidden, errNotEventManager)
+		return
+	}
+
+	var body struct {
+		ImageIds []int `json:"image_ids"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	before, err := models.FindEventImages(r.Context(), s.db, eventId, true)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = models.ReorderEventImages(r.Context(), s.db, eventId, body.ImageIds)
+	if errors.Is(err, models.ErrEventImageOrder) {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindEventImages(r.Context(), s.db, eventId, true)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceEventImage, eventId, before, after)
+
+	responses.Json(w, http.StatusOK, after)
+}
+
+// RemoveEventImage removes a photo from an event's gallery, which also
+// rejects a pending photo. Editors and the event's managers can remove any
+// photo, and members can remove the photos they submitted.
+func (s *Server) RemoveEventImage(w http.ResponseWriter, r *http.Request) {
+	eventId, imageId, err := eventImageParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	_, manager, ok := s.findGalleryEvent(w, r, eventId)
+	if !ok {
+		return
+	}
+
+	before, err := models.FindEventImage(r.Context(), s.db, eventId, imageId)
+	if errors.Is(err, models.ErrEventImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !manager && (before.SubmittedBy == nil || *before.SubmittedBy != user.ID) {
+		responses.Error(w, http.StatusForbidden, errNotGalleryImageOwner)
+		return
+	}
+
+	err = models.DeleteEventImage(r.Context(), s.db, eventId, imageId)
+	if errors.Is(err, models.ErrEventImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionDelete, models.AuditResourceEventImage, eventId, before, nil)
+
+	responses.Json(w, http.StatusNoContent, nil)
+}
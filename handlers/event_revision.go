@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+var errNonNumericRevision = errors.New("revision must be an integer")
+
+// ListEventRevisions lists the revisions of an event, newest first.
+func (s *Server) ListEventRevisions(w http.ResponseWriter, r *http.Request) {
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		err = errors.Join(errNonNumericEventId, err)
+		responses.Error(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if _, err := models.FindEventById(r.Context(), s.db, eventId, false); err != nil {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+
+	revisions, err := models.FindEventRevisions(r.Context(), s.db, eventId)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, revisions)
+}
+
+// GetEventRevision returns a single revision of an event with its snapshot.
+func (s *Server) GetEventRevision(w http.ResponseWriter, r *http.Request) {
+	eventId, revision, err := eventRevisionParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rev, err := models.FindEventRevision(r.Context(), s.db, eventId, revision)
+	if errors.Is(err, models.ErrEventRevisionNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.hideOnlineAccess(r, rev.Snapshot); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, rev)
+}
+
+// DiffEventRevisions returns the fields that changed between the revisions
+// given by the from and to query parameters.
+func (s *Server) DiffEventRevisions(w http.ResponseWriter, r *http.Request) {
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		err = errors.Join(errNonNumericEventId, err)
+		responses.Error(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.New("from must be a revision number"))
+		return
+	}
+
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.New("to must be a revision number"))
+		return
+	}
+
+	revisions := make([]*models.EventRevision, 2)
+	for i, revision := range []int{from, to} {
+		revisions[i], err = models.FindEventRevision(r.Context(), s.db, eventId, revision)
+		if errors.Is(err, models.ErrEventRevisionNotFound) {
+			responses.Error(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			responses.Error(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	err = s.hideOnlineAccess(r, revisions[0].Snapshot, revisions[1].Snapshot)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	changes, err := models.Diff(revisions[0].Snapshot, revisions[1].Snapshot)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := map[string]any{
+		"event_id": eventId,
+		"from":     from,
+		"to":       to,
+		"changes":  changes,
+	}
+	responses.Json(w, http.StatusOK, res)
+}
+
+// RollbackEvent restores an event to a previous revision. The rollback is
+// recorded as a new revision.
+func (s *Server) RollbackEvent(w http.ResponseWriter, r *http.Request) {
+	eventId, revision, err := eventRevisionParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	before, err := models.FindEventById(r.Context(), s.db, eventId, false)
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !s.requireEventManager(w, r, before.OrganizationId) {
+		return
+	}
+
+	// Rollbacks are POSTed, so If-Match is optional. Without it the rollback
+	// applies to the event as it was just fetched.
+	version := before.Version
+	if r.Header.Get("If-Match") != "" {
+		var ok bool
+		if version, ok = ifMatchVersion(w, r, before.Version); !ok {
+			return
+		}
+	}
+
+	rev, err := models.FindEventRevision(r.Context(), s.db, eventId, revision)
+	if errors.Is(err, models.ErrEventRevisionNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// As with updates, managers can't restore a primary host they don't
+	// manage, nor bring back co-hosts they don't manage.
+	hosts := append([]*int{rev.Snapshot.OrganizationId}, addedHosts(before.OrganizationIds, rev.Snapshot.OrganizationIds)...)
+	if !s.requireEventManager(w, r, hosts...) {
+		return
+	}
+
+	// The organization or location the revision referenced may have been
+	// removed since. Its image may have been garbage collected too, the event
+	// is then rolled back without an image.
+	snapshot := *rev.Snapshot
+	snapshot.ImageId = nil
+	err = s.Validator.ValidateNewEvent(r.Context(), snapshot)
+	if err != nil {
+		responses.Error(w, http.StatusConflict, err)
+		return
+	}
+
+	after, err := models.RollbackEvent(r.Context(), s.db, eventId, revision, version, currentUserId(r))
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionRollback, models.AuditResourceEvent, eventId, before, after)
+
+	if err := s.prepareEvents(r, after); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, after.Version)
+	responses.Json(w, http.StatusOK, after)
+}
+
+// eventRevisionParams parses the event id and revision number from the path.
+func eventRevisionParams(r *http.Request) (eventId, revision int, err error) {
+	params := mux.Vars(r)
+
+	eventId, err = strconv.Atoi(params["id"])
+	if err != nil {
+		return 0, 0, errors.Join(errNonNumericEventId, err)
+	}
+
+	revision, err = strconv.Atoi(params["revision"])
+	if err != nil {
+		return 0, 0, errors.Join(errNonNumericRevision, err)
+	}
+
+	return eventId, revision, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	conn "github.com/somos831/somos-backend/db"
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/responses"
+)
+
+// readinessTimeout bounds how long readiness checks wait for the database.
+const readinessTimeout = 2 * time.Second
+
+// Statuses of health checks.
+const (
+	healthOK           = "ok"
+	healthFailing      = "failing"
+	healthShuttingDown = "shutting_down"
+)
+
+// Errors reported by readiness checks. Anonymous callers see these rather
+// than the underlying errors, which are logged.
+var (
+	errDatabaseUnreachable = errors.New("database is unreachable")
+	errMigrationsUnknown   = errors.New("migration version could not be read")
+	errMigrationsDirty     = errors.New("the last migration failed, the schema is dirty")
+)
+
+// healthCheck reports the status of one of the server's dependencies.
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Version and Expected are the migration versions of the database and
+	// the server, for the migrations check.
+	Version  *uint `json:"version,omitempty"`
+	Expected *uint `json:"expected,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// Healthz reports that the process is alive and serving requests. It checks
+// no dependency, so that an unavailable database doesn't get the server
+// restarted.
+func (s *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	responses.Json(w, http.StatusOK, map[string]string{"status": healthOK})
+}
+
+// Readyz reports whether the server can serve requests: the database must be
+// reachable and migrated at least to the newest migration the server was
+// built with. The server stops being ready as soon as it starts shutting
+// down, so that no new requests are sent its way.
+func (s *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	res := readiness{
+		Status: healthOK,
+		Checks: map[string]healthCheck{
+			"database":   s.checkDatabase(ctx),
+			"migrations": s.checkMigrations(ctx),
+		},
+	}
+
+	for _, check := range res.Checks {
+		if check.Status != healthOK {
+			res.Status = healthFailing
+		}
+	}
+
+	if s.shuttingDown.Load() {
+		res.Status = healthShuttingDown
+	}
+
+	status := http.StatusOK
+	if res.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	responses.Json(w, status, res)
+}
+
+// isProbe reports whether r was made by a health check, which isn't worth
+// tracing.
+func isProbe(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz":
+		return true
+	}
+
+	return false
+}
+
+// checkDatabase checks that the database answers pings.
+func (s *Server) checkDatabase(ctx context.Context) healthCheck {
+	if err := s.db.PingContext(ctx); err != nil {
+		logging.FromContext(ctx).Error("failed to ping database", "error", err)
+
+		return healthCheck{Status: healthFailing, Error: errDatabaseUnreachable.Error()}
+	}
+
+	return healthCheck{Status: healthOK}
+}
+
+// checkMigrations checks that the database has been migrated at least to the
+// newest migration embedded in the server. Newer versions are accepted so
+// that servers still running the previous release stay ready while a new
+// one rolls out.
+func (s *Server) checkMigrations(ctx context.Context) healthCheck {
+	expected, err := conn.ExpectedMigration()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to read embedded migrations", "error", err)
+
+		return healthCheck{Status: healthFailing, Error: errMigrationsUnknown.Error()}
+	}
+
+	check := healthCheck{Status: healthOK, Expected: &expected}
+
+	version, dirty, err := conn.MigrationVersion(ctx, s.db)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to read migration version", "error", err)
+		check.Status, check.Error = healthFailing, errMigrationsUnknown.Error()
+
+		return check
+	}
+	check.Version = &version
+
+	if dirty {
+		check.Status, check.Error = healthFailing, errMigrationsDirty.Error()
+	} else if version < expected {
+		check.Status = healthFailing
+		check.Error = fmt.Sprintf("database is at migration %d, %d is expected", version, expected)
+	}
+
+	return check
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	conn "github.com/somos831/somos-backend/db"
+)
+
+// fakeConnector stands in for MySQL in readiness checks. Its connections
+// answer pings and report that the database is at the migration the server
+// expects, or fail with err.
+type fakeConnector struct {
+	err error
+}
+
+type fakeConn struct {
+	err error
+}
+
+type migrationRows struct {
+	version uint
+	done    bool
+}
+
+func newFakeDB(t *testing.T, err error) *sql.DB {
+	db := sql.OpenDB(fakeConnector{err: err})
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+func (c fakeConn) Ping(context.Context) error        { return c.err }
+
+func (c fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	version, err := conn.ExpectedMigration()
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrationRows{version: version}, nil
+}
+
+func (*migrationRows) Columns() []string { return []string{"version", "dirty"} }
+func (*migrationRows) Close() error      { return nil }
+
+func (r *migrationRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1] = int64(r.version), false
+
+	return nil
+}
+
+func TestReadyz(t *testing.T) {
+	driverErr := errors.New("dial tcp 10.0.0.5:3306: connect: connection refused")
+
+	tests := []struct {
+		name         string
+		err          error
+		shuttingDown bool
+		wantCode     int
+		wantStatus   string
+	}{
+		{name: "ready", wantCode: http.StatusOK, wantStatus: healthOK},
+		{name: "database down", err: driverErr, wantCode: http.StatusServiceUnavailable, wantStatus: healthFailing},
+		{name: "shutting down", shuttingDown: true, wantCode: http.StatusServiceUnavailable, wantStatus: healthShuttingDown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Server{db: newFakeDB(t, test.err)}
+			s.shuttingDown.Store(test.shuttingDown)
+
+			rec := httptest.NewRecorder()
+			s.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != test.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, test.wantCode)
+			}
+			if strings.Contains(rec.Body.String(), "10.0.0.5") {
+				t.Errorf("body %s reveals the driver's error", rec.Body)
+			}
+
+			var res readiness
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != test.wantStatus {
+				t.Errorf("status = %q, want %q", res.Status, test.wantStatus)
+			}
+
+			if test.err != nil {
+				if got := res.Checks["database"].Error; got != errDatabaseUnreachable.Error() {
+					t.Errorf("database error = %q, want %q", got, errDatabaseUnreachable)
+				}
+				if got := res.Checks["migrations"].Error; got != errMigrationsUnknown.Error() {
+					t.Errorf("migrations error = %q, want %q", got, errMigrationsUnknown)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/imaging"
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+	_ "golang.org/x/image/webp"
+)
+
+// maxImageBytes is the largest image file that can be uploaded.
+const maxImageBytes = 10 << 20
+
+// imageProcessing limits how many uploads are decoded and resized at once.
+// Each one holds several copies of an image's pixels in memory, which for the
+// largest images accepted take hundreds of megabytes.
+var imageProcessing = make(chan struct{}, min(runtime.GOMAXPROCS(0), 4))
+
+// imageExtensions maps the image types that can be uploaded to the extension
+// of their files.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// imageKind describes how uploaded images are processed.
+type imageKind struct {
+	// specs are the variants generated for the image.
+	specs []imaging.Spec
+	// square, when set, crops the image to a square at most this many
+	// pixels wide before it is stored.
+	square int
+}
+
+// variantNames returns the names of the variants generated for the image.
+func (kind imageKind) variantNames() []string {
+	names := []string{}
+	for _, spec := range kind.specs {
+		names = append(names, spec.Name)
+	}
+
+	return names
+}
+
+var (
+	eventImage  = imageKind{specs: imaging.Specs}
+	avatarImage = imageKind{specs: imaging.AvatarSpecs, square: imaging.AvatarSize}
+)
+
+var (
+	errNonNumericImageId    = errors.New("image id must be an integer")
+	errImageTooLarge        = fmt.Errorf("image cannot be larger than %d MB", maxImageBytes>>20)
+	errMissingImage         = errors.New("the image must be uploaded as the \"image\" field of a multipart form")
+	errUnsupportedImageType = errors.New("image must be a JPEG, PNG, GIF or WebP file")
+	errStorageUnavailable   = errors.New("image uploads aren't configured")
+	errImageProcessingBusy  = errors.New("too many images are being processed, try again later")
+)
+
+// GetImage returns a single image by its id.
+func (s *Server) GetImage(w http.ResponseWriter, r *http.Request) {
+	imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericImageId)
+		return
+	}
+
+	img, err := models.FindImageById(r.Context(), s.db, imageID)
+	if errors.Is(err, models.ErrImageNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, img)
+}
+
+// UploadImage stores an image uploaded as the "image" field of a multipart
+// form, along with its "alt" text. The image's type is sniffed from its
+// content, whatever its filename or declared type.
+func (s *Server) UploadImage(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	if s.Storage == nil {
+		responses.Error(w, http.StatusServiceUnavailable, errStorageUnavailable)
+		return
+	}
+
+	data, filename, status, err := readImageUpload(w, r)
+	if err != nil {
+		responses.Error(w, status, err)
+		return
+	}
+
+	img, status, err := s.storeImage(r, data, filename, r.FormValue("alt"), eventImage)
+	if err != nil {
+		responses.Error(w, status, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionCreate, models.AuditResourceImage, img.Id, nil, img)
+	s.Metrics.ImagesUploaded.Inc()
+
+	responses.Json(w, http.StatusCreated, img)
+}
+
+// readImageUpload reads the "image" field of a multipart form, returning the
+// file and its name. On failure, the status to respond with is returned.
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, string, int, error) {
+	// Leave room for the other fields of the form.
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+
+	file, header, err := r.FormFile("image")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, "", http.StatusRequestEntityTooLarge, errImageTooLarge
+	}
+	if err != nil {
+		return nil, "", http.StatusBadRequest, errMissingImage
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	if len(data) > maxImageBytes {
+		return nil, "", http.StatusRequestEntityTooLarge, errImageTooLarge
+	}
+
+	return data, filepath.Base(header.Filename), 0, nil
+}
+
+// storeImage checks that data is an image that can be uploaded, then saves
+// it to storage along with the variants of kind and records them in the
+// database. Metadata such as the GPS position a photo was taken at is removed
+// first. On failure, the status to respond with is returned.
+func (s *Server) storeImage(r *http.Request, data []byte, filename, alt string, kind imageKind) (*models.Image, int, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := imageExtensions[contentType]; !ok {
+		return nil, http.StatusUnsupportedMediaType, errUnsupportedImageType
+	}
+
+	// Only the header is decoded, so huge images are rejected before their
+	// pixels are read.
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != contentType {
+		return nil, http.StatusUnsupportedMediaType, errUnsupportedImageType
+	}
+
+	img := models.Image{
+		Filename:    filename,
+		Alt:         alt,
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		UploadedBy:  currentUserId(r),
+	}
+
+	err = s.Validator.NewImage(img)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	// Wait for a slot until the request times out. The slot is released as
+	// soon as the variants are generated, before they are stored.
+	select {
+	case imageProcessing <- struct{}{}:
+	case <-r.Context().Done():
+		return nil, http.StatusServiceUnavailable, errImageProcessingBusy
+	}
+	release := sync.OnceFunc(func() { <-imageProcessing })
+	defer release()
+
+	decoded, err := imaging.Decode(data)
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, errUnsupportedImageType
+	}
+
+	// Re-encoding drops metadata, so cropped images are simply re-encoded.
+	// Photos taken sideways are only upright thanks to their EXIF
+	// orientation, which would be stripped with the rest of the metadata, so
+	// they are re-encoded upright too.
+	switch {
+	case kind.square > 0:
+		decoded = imaging.Resize(decoded, imaging.Spec{Width: kind.square, Height: kind.square})
+		if contentType == "image/png" || contentType == "image/gif" {
+			contentType = "image/png"
+			data, err = imaging.EncodePNG(decoded)
+		} else {
+			contentType = "image/jpeg"
+			data, err = imaging.EncodeJPEG(decoded)
+		}
+		img.ContentType = contentType
+	case imaging.Orientation(data) != 1:
+		data, err = imaging.EncodeJPEG(decoded)
+	default:
+		data, err = imaging.StripMetadata(data, contentType)
+	}
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, errUnsupportedImageType
+	}
+
+	img.SizeBytes = len(data)
+	img.Width, img.Height = decoded.Bounds().Dx(), decoded.Bounds().Dy()
+
+	// Identical uploads share their files and variants.
+	sum := sha256.Sum256(data)
+	contentHash := hex.EncodeToString(sum[:])
+	img.ContentHash = &contentHash
+
+	existing, err := models.FindImageByHash(r.Context(), s.db, contentHash, kind.variantNames())
+	if err != nil && !errors.Is(err, models.ErrImageNotFound) {
+		return nil, http.StatusInternalServerError, err
+	}
+	if existing != nil {
+		img.Id, err = models.InsertImageCopy(r.Context(), s.db, existing.Id, img)
+		if err == nil {
+			return s.findStoredImage(r, img.Id)
+		}
+
+		// The existing image was garbage collected in the meantime.
+		if !errors.Is(err, models.ErrImageNotFound) {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	generated, err := imaging.Generate(decoded, contentType, kind.specs)
+	release()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	base, err := newStorageKey("images/")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	key := base + imageExtensions[contentType]
+	img.StorageKey = &key
+	img.Url = s.Storage.URL(key)
+
+	files := []storedFile{{key: key, data: data, contentType: contentType}}
+	variants := []models.ImageVariant{}
+	for _, v := range generated {
+		variantKey := base + "-" + v.Name + imageExtensions[v.ContentType]
+		files = append(files, storedFile{key: variantKey, data: v.Data, contentType: v.ContentType})
+
+		variants = append(variants, models.ImageVariant{
+			Name:        v.Name,
+			ContentType: v.ContentType,
+			Width:       v.Width,
+			Height:      v.Height,
+			SizeBytes:   len(v.Data),
+			StorageKey:  variantKey,
+			Url:         s.Storage.URL(variantKey),
+		})
+	}
+
+	err = s.putFiles(r.Context(), files)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to store image", "error", err)
+		return nil, http.StatusInternalServerError, errors.New("failed to store image")
+	}
+
+	img.Id, err = models.InsertImageWithVariants(r.Context(), s.db, img, variants)
+	if err != nil {
+		s.deleteFiles(context.WithoutCancel(r.Context()), files)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return s.findStoredImage(r, img.Id)
+}
+
+// findStoredImage finds the image imageId that was just stored.
+func (s *Server) findStoredImage(r *http.Request, imageId int) (*models.Image, int, error) {
+	img, err := models.FindImageById(r.Context(), s.db, imageId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return img, 0, nil
+}
+
+// storedFile is a file to save to storage.
+type storedFile struct {
+	key         string
+	data        []byte
+	contentType string
+}
+
+// putFiles saves files to storage. If any of them can't be saved, the ones
+// already saved are deleted.
+func (s *Server) putFiles(ctx context.Context, files []storedFile) error {
+	for i, file := range files {
+		if err := s.Storage.Put(ctx, file.key, file.data, file.contentType); err != nil {
+			s.deleteFiles(context.WithoutCancel(ctx), files[:i])
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteFiles removes files from storage, logging failures since there is
+// nothing more to be done about them.
+func (s *Server) deleteFiles(ctx context.Context, files []storedFile) {
+	for _, file := range files {
+		if err := s.Storage.Delete(ctx, file.key); err != nil {
+			logging.FromContext(ctx).Error("failed to delete stored file", "error", err, "key", file.key)
+		}
+	}
+}
+
+// newStorageKey returns a random storage key starting with prefix.
+func newStorageKey(prefix string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/models"
+)
+
+const imageGCBatchSize = 100
+
+// sweepImages removes unreferenced images every interval until ctx is done.
+func (s *Server) sweepImages(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := models.CollectImageGarbage(ctx, s.db, s.Storage, time.Now().Add(-grace), imageGCBatchSize)
+			if err != nil {
+				logging.FromContext(ctx).Error("failed to collect unreferenced images", "error", err)
+				continue
+			}
+			if removed > 0 {
+				logging.FromContext(ctx).Info("removed unreferenced images", "count", removed)
+			}
+		}
+	}
+}
@@ -1,13 +1,82 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
 
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/geocoding"
+	"github.com/somos831/somos-backend/logging"
 	"github.com/somos831/somos-backend/models"
 	"github.com/somos831/somos-backend/responses"
 )
 
+var (
+	errNonNumericLocationId = errors.New("location id must be an integer")
+	errDuplicateLocation    = errors.New("similar locations already exist, reuse one of the candidates or retry with ?force=true")
+)
+
+// ListLocations lists locations ordered by name. Use ?q= to only list
+// locations whose name or address contains a search term.
+func (s *Server) ListLocations(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			responses.Error(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+
+		limit = n
+	}
+
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	locations, err := models.FindLocations(r.Context(), s.db, r.URL.Query().Get("q"), limit, withDeleted)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, locations)
+}
+
+// GetLocation returns a single location by its id.
+func (s *Server) GetLocation(w http.ResponseWriter, r *http.Request) {
+	locationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericLocationId)
+		return
+	}
+
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	location, err := models.FindLocationById(r.Context(), s.db, locationID, withDeleted)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, location.Version)
+	responses.Json(w, http.StatusOK, location)
+}
+
+// CreateLocation creates a new location. If similar locations already exist
+// they are returned as candidates with a 409 instead, unless ?force=true.
 func (s *Server) CreateLocation(w http.ResponseWriter, r *http.Request) {
 	var location models.Location
 
@@ -23,15 +92,342 @@ func (s *Server) CreateLocation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.locate(r.Context(), &location)
+
+	// Warn about likely duplicates, the client can create the location anyway
+	// with ?force=true.
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if !force {
+		duplicates, err := models.FindDuplicateLocations(r.Context(), s.db, location)
+		if err != nil {
+			responses.Error(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if len(duplicates) > 0 {
+			responses.Json(w, http.StatusConflict, struct {
+				Error      string                 `json:"error"`
+				Candidates []models.LocationMatch `json:"candidates"`
+			}{
+				Error:      errDuplicateLocation.Error(),
+				Candidates: duplicates,
+			})
+
+			return
+		}
+	}
+
 	locationID, err := models.InsertLocation(r.Context(), s.db, location)
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	location.Id = locationID
+	s.audit(r, models.AuditActionCreate, models.AuditResourceLocation, locationID, nil, location)
+
 	res := map[string]int{
 		"location_id": locationID,
 	}
 
 	responses.Json(w, http.StatusCreated, res)
 }
+
+// UpdateLocation replaces a location by its id. Only editors can update
+// locations, since they are shared by every organization's events.
+func (s *Server) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	if !requireEditor(w, r) {
+		return
+	}
+
+	locationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericLocationId)
+		return
+	}
+
+	before, err := models.FindLocationById(r.Context(), s.db, locationID, false)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, before.Version)
+	if !ok {
+		return
+	}
+
+	var location models.Location
+	err = json.NewDecoder(r.Body).Decode(&location)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	location.Id = locationID
+	location.Version = version
+
+	err = s.Validator.NewLocation(location)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.relocate(r.Context(), *before, &location)
+
+	err = models.UpdateLocation(r.Context(), s.db, location)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindLocationById(r.Context(), s.db, locationID, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceLocation, locationID, before, after)
+
+	setETag(w, after.Version)
+	responses.Json(w, http.StatusOK, after)
+}
+
+// DeleteLocation deletes a location by its id. Only editors can delete
+// locations, and locations used by an event can't be deleted.
+func (s *Server) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	if !requireEditor(w, r) {
+		return
+	}
+
+	locationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericLocationId)
+		return
+	}
+
+	before, err := models.FindLocationById(r.Context(), s.db, locationID, false)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, before.Version)
+	if !ok {
+		return
+	}
+
+	err = models.DeleteLocation(r.Context(), s.db, locationID, version)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
+	if errors.Is(err, models.ErrLocationInUse) {
+		responses.Error(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindLocationById(r.Context(), s.db, locationID, true)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionDelete, models.AuditResourceLocation, locationID, before, after)
+
+	responses.Json(w, http.StatusNoContent, nil)
+}
+
+// MergeLocations merges the locations listed in the body into the location
+// with the given id. Events at the merged locations are moved over and the
+// merged locations are deleted.
+func (s *Server) MergeLocations(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	survivorID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericLocationId)
+		return
+	}
+
+	var body struct {
+		LocationIds []int `json:"location_ids"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(body.LocationIds) == 0 {
+		responses.Error(w, http.StatusBadRequest, errors.New("location_ids cannot be empty"))
+		return
+	}
+
+	if slices.Contains(body.LocationIds, survivorID) {
+		responses.Error(w, http.StatusBadRequest, errors.New("a location can't be merged into itself"))
+		return
+	}
+
+	moved, err := models.MergeLocations(r.Context(), s.db, survivorID, body.LocationIds, currentUserId(r))
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := map[string]any{
+		"location_id":         survivorID,
+		"merged_location_ids": body.LocationIds,
+		"events_moved":        moved,
+	}
+
+	s.audit(r, models.AuditActionMerge, models.AuditResourceLocation, survivorID, nil, res)
+
+	responses.Json(w, http.StatusOK, res)
+}
+
+// RestoreLocation restores a soft-deleted location by its id.
+func (s *Server) RestoreLocation(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	params := mux.Vars(r)
+
+	locationID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericLocationId)
+		return
+	}
+
+	before, err := models.FindLocationById(r.Context(), s.db, locationID, true)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, errors.New("no deleted location with given id"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = models.RestoreLocation(r.Context(), s.db, locationID)
+	if errors.Is(err, models.ErrLocationNotFound) {
+		responses.Error(w, http.StatusNotFound, errors.New("no deleted location with given id"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	location, err := models.FindLocationById(r.Context(), s.db, locationID, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionRestore, models.AuditResourceLocation, locationID, before, location)
+
+	setETag(w, location.Version)
+	responses.Json(w, http.StatusOK, location)
+}
+
+// locate geocodes the address of location to fill in its coordinates and
+// normalize the address, unless coordinates were given. A map URL is generated
+// when none was given and one fits. Geocoding failures aren't fatal, the
+// location is then saved without coordinates.
+func (s *Server) locate(ctx context.Context, location *models.Location) {
+	if location.Latitude == nil && s.Geocoder != nil {
+		result, err := s.Geocoder.Geocode(ctx, location.Address)
+		if errors.Is(err, geocoding.ErrNoResults) {
+			logging.FromContext(ctx).Warn("no geocoding results for address", "address", location.Address)
+		} else if err != nil {
+			logging.FromContext(ctx).Error("failed to geocode address", "error", err, "address", location.Address)
+		} else {
+			location.Latitude = &result.Latitude
+			location.Longitude = &result.Longitude
+
+			if result.Address != "" && len(result.Address) <= 255 {
+				location.Address = result.Address
+			}
+		}
+	}
+
+	if location.MapURL == "" {
+		location.MapURL = mapURL(*location)
+	}
+}
+
+// relocate locates location, the new version of before. When its address
+// changed, the coordinates and generated map URL of before that were sent back
+// unchanged belong to the old address, so they are replaced.
+func (s *Server) relocate(ctx context.Context, before models.Location, location *models.Location) {
+	if location.Address != before.Address {
+		if equalCoordinate(location.Latitude, before.Latitude) &&
+			equalCoordinate(location.Longitude, before.Longitude) {
+			location.Latitude, location.Longitude = nil, nil
+		}
+
+		if location.MapURL != "" && location.MapURL == mapURL(before) {
+			location.MapURL = ""
+		}
+	}
+
+	s.locate(ctx, location)
+}
+
+// mapURL returns the map URL generated for location, centered on its
+// coordinates or searching for its address when they aren't known. It is empty
+// when the URL doesn't fit in the map_url column, as search URLs for long
+// addresses can once escaped.
+func mapURL(location models.Location) string {
+	var url string
+	if location.Latitude != nil && location.Longitude != nil {
+		url = geocoding.MapURL(*location.Latitude, *location.Longitude)
+	} else {
+		url = geocoding.SearchURL(location.Address)
+	}
+
+	if len(url) > 255 {
+		return ""
+	}
+
+	return url
+}
+
+func equalCoordinate(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
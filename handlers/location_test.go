@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/somos831/somos-backend/geocoding"
+	"github.com/somos831/somos-backend/models"
+)
+
+func coordinate(v float64) *float64 {
+	return &v
+}
+
+func testGeocoder() geocoding.Static {
+	return geocoding.Static{
+		"1 Old St": {Latitude: 36.6, Longitude: -121.9, Address: "1 Old St, Seaside, CA 93955"},
+		"2 New St": {Latitude: 36.7, Longitude: -121.6, Address: "2 New St, Salinas, CA 93901"},
+	}
+}
+
+func TestLocateNewLocation(t *testing.T) {
+	longAddress := strings.Repeat("Long Street Name ", 14)
+
+	tests := []struct {
+		name     string
+		location models.Location
+		want     models.Location
+	}{
+		{
+			name:     "geocoded",
+			location: models.Location{Address: "1 old st"},
+			want: models.Location{
+				Address:   "1 Old St, Seaside, CA 93955",
+				Latitude:  coordinate(36.6),
+				Longitude: coordinate(-121.9),
+				MapURL:    geocoding.MapURL(36.6, -121.9),
+			},
+		},
+		{
+			name:     "unknown address",
+			location: models.Location{Address: "3 Unknown St"},
+			want: models.Location{
+				Address: "3 Unknown St",
+				MapURL:  geocoding.SearchURL("3 Unknown St"),
+			},
+		},
+		{
+			name: "coordinates given",
+			location: models.Location{
+				Address:   "1 Old St",
+				Latitude:  coordinate(1),
+				Longitude: coordinate(2),
+			},
+			want: models.Location{
+				Address:   "1 Old St",
+				Latitude:  coordinate(1),
+				Longitude: coordinate(2),
+				MapURL:    geocoding.MapURL(1, 2),
+			},
+		},
+		{
+			name:     "map URL given",
+			location: models.Location{Address: "3 Unknown St", MapURL: "https://maps.example.com/3"},
+			want:     models.Location{Address: "3 Unknown St", MapURL: "https://maps.example.com/3"},
+		},
+		{
+			name:     "search URL too long",
+			location: models.Location{Address: longAddress},
+			want:     models.Location{Address: longAddress},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Server{Geocoder: testGeocoder()}
+
+			location := test.location
+			s.locate(context.Background(), &location)
+
+			assertLocation(t, location, test.want)
+		})
+	}
+}
+
+func TestRelocateUpdatedLocation(t *testing.T) {
+	before := models.Location{
+		Address:   "1 Old St, Seaside, CA 93955",
+		Latitude:  coordinate(36.6),
+		Longitude: coordinate(-121.9),
+		MapURL:    geocoding.MapURL(36.6, -121.9),
+	}
+
+	tests := []struct {
+		name     string
+		location models.Location
+		want     models.Location
+	}{
+		{
+			name:     "unchanged",
+			location: before,
+			want:     before,
+		},
+		{
+			name: "address changed",
+			location: models.Location{
+				Address:   "2 New St",
+				Latitude:  before.Latitude,
+				Longitude: before.Longitude,
+				MapURL:    before.MapURL,
+			},
+			want: models.Location{
+				Address:   "2 New St, Salinas, CA 93901",
+				Latitude:  coordinate(36.7),
+				Longitude: coordinate(-121.6),
+				MapURL:    geocoding.MapURL(36.7, -121.6),
+			},
+		},
+		{
+			name: "address changed to an unknown one",
+			location: models.Location{
+				Address:   "3 Unknown St",
+				Latitude:  before.Latitude,
+				Longitude: before.Longitude,
+				MapURL:    before.MapURL,
+			},
+			want: models.Location{
+				Address: "3 Unknown St",
+				MapURL:  geocoding.SearchURL("3 Unknown St"),
+			},
+		},
+		{
+			name: "address changed with a custom map URL",
+			location: models.Location{
+				Address:   "2 New St",
+				Latitude:  before.Latitude,
+				Longitude: before.Longitude,
+				MapURL:    "https://maps.example.com/2",
+			},
+			want: models.Location{
+				Address:   "2 New St, Salinas, CA 93901",
+				Latitude:  coordinate(36.7),
+				Longitude: coordinate(-121.6),
+				MapURL:    "https://maps.example.com/2",
+			},
+		},
+		{
+			name: "address and coordinates changed",
+			location: models.Location{
+				Address:   "2 New St",
+				Latitude:  coordinate(1),
+				Longitude: coordinate(2),
+				MapURL:    before.MapURL,
+			},
+			want: models.Location{
+				Address:   "2 New St",
+				Latitude:  coordinate(1),
+				Longitude: coordinate(2),
+				MapURL:    geocoding.MapURL(1, 2),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Server{Geocoder: testGeocoder()}
+
+			location := test.location
+			s.relocate(context.Background(), before, &location)
+
+			assertLocation(t, location, test.want)
+		})
+	}
+}
+
+func assertLocation(t *testing.T, got, want models.Location) {
+	t.Helper()
+
+	if got.Address != want.Address {
+		t.Errorf("address = %q, want %q", got.Address, want.Address)
+	}
+	if !equalCoordinate(got.Latitude, want.Latitude) || !equalCoordinate(got.Longitude, want.Longitude) {
+		t.Errorf("coordinates = %v, %v, want %v, %v",
+			formatCoordinate(got.Latitude), formatCoordinate(got.Longitude),
+			formatCoordinate(want.Latitude), formatCoordinate(want.Longitude))
+	}
+	if got.MapURL != want.MapURL {
+		t.Errorf("map URL = %q, want %q", got.MapURL, want.MapURL)
+	}
+}
+
+func formatCoordinate(c *float64) any {
+	if c == nil {
+		return nil
+	}
+
+	return *c
+}
@@ -2,18 +2,189 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/logging"
 )
 
-func ContextMiddleware(next http.Handler) http.Handler {
+const requestIdHeader = "X-Request-ID"
+
+// maxRequestIdLength bounds the request ids accepted from clients, longer
+// ones are replaced.
+const maxRequestIdLength = 128
+
+// ContextMiddleware bounds the context of every request by timeout.
+func ContextMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Create a new context for the request
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			// Pass the context to the next handler in the chain
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIdMiddleware gives every request an id, the X-Request-ID header
+// sent by the client or proxy when there is a valid one. The id is sent back
+// in the response's X-Request-ID header and logged with every message logged
+// through the request context.
+func RequestIdMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Create a new context for the request
-		ctx := r.Context()
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
+		requestId := r.Header.Get(requestIdHeader)
+		if !validRequestId(requestId) {
+			requestId = newRequestId()
+		}
 
-		// Pass the context to the next handler in the chain
+		w.Header().Set(requestIdHeader, requestId)
+
+		ctx := logging.WithRequestId(r.Context(), requestId)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// validRequestId reports whether a request id received from a client is
+// short and only made of printable ASCII characters, so that it can't forge
+// log lines.
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+
+	for _, c := range requestId {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestId returns a random request id.
+func newRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+type accessLogContextKey struct{}
+
+// accessLogEntry collects what the access log records about a request that
+// is only known further down the middleware chain.
+type accessLogEntry struct {
+	userId *int
+}
+
+// setAccessLogUser records the user making the request in its access log
+// entry.
+func setAccessLogUser(r *http.Request, userId int) {
+	if entry, ok := r.Context().Value(accessLogContextKey{}).(*accessLogEntry); ok {
+		entry.userId = &userId
+	}
+}
+
+// statusRecorder records the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+
+	return n, err
+}
+
+// Status returns the status of the response, 200 if the handler never set
+// one.
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+
+	return rec.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// AccessLogMiddleware logs a line for every request once it has been served,
+// with its method, path, status, latency and the id of the user who made it.
+// Server errors are logged at the error level.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{}
+		rec := &statusRecorder{ResponseWriter: w}
+
+		ctx := context.WithValue(r.Context(), accessLogContextKey{}, entry)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status()),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if entry.userId != nil {
+			attrs = append(attrs, slog.Int("user_id", *entry.userId))
+		}
+
+		logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// unmatchedRoute labels the metrics of requests that matched no route.
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware records the count and latency of requests by the template
+// of the route they match, so that /events/1 and /events/2 are counted
+// together, along with how many requests are being served.
+func (s *Server) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := s.Metrics.RequestStarted()
+		defer done()
+
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if s.Router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		s.Metrics.ObserveRequest(r.Method, route, rec.Status(), time.Since(start))
+	})
+}
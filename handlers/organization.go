@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+var errNonNumericOrganizationId = errors.New("organization id must be an integer")
+
+// ListOrganizations lists organizations ordered by name.
+func (s *Server) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			responses.Error(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+
+		limit = n
+	}
+
+	orgs, err := models.FindOrganizations(r.Context(), s.db, limit)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, orgs)
+}
+
+// GetOrganization returns a single organization by its id.
+func (s *Server) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericOrganizationId)
+		return
+	}
+
+	org, err := models.FindOrganizationById(r.Context(), s.db, orgID)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, org)
+}
+
+// ListOrganizationEvents lists the upcoming events hosted by an organization,
+// soonest first.
+func (s *Server) ListOrganizationEvents(w http.ResponseWriter, r *http.Request) {
+	orgID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericOrganizationId)
+		return
+	}
+
+	limit := 15
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			responses.Error(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+
+		limit = n
+	}
+
+	_, err = models.FindOrganizationById(r.Context(), s.db, orgID)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	events, err := models.FindEvents(r.Context(), s.db, models.EventFilter{
+		Limit:          limit,
+		OrganizationId: &orgID,
+		Upcoming:       true,
+	})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	eventPtrs := make([]*models.Event, len(events))
+	for i := range events {
+		eventPtrs[i] = &events[i]
+	}
+
+	if err := s.prepareEvents(r, eventPtrs...); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, events)
+}
+
+// CreateOrganization creates a new organization. Only editors and
+// administrators can create organizations.
+func (s *Server) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	if !requireEditor(w, r) {
+		return
+	}
+
+	var org models.Organization
+	err := json.NewDecoder(r.Body).Decode(&org)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	org.Id = 0
+
+	err = s.Validator.ValidateOrganization(r.Context(), org)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	orgID, err := models.InsertOrganization(r.Context(), s.db, org)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	org.Id = orgID
+	s.audit(r, models.AuditActionCreate, models.AuditResourceOrganization, orgID, nil, org)
+
+	res := map[string]int{
+		"organization_id": orgID,
+	}
+
+	responses.Json(w, http.StatusCreated, res)
+}
+
+// UpdateOrganization replaces an organization by its id. Only editors and the
+// organization's owners can update it.
+func (s *Server) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericOrganizationId)
+		return
+	}
+
+	if !s.requireOrganizationRole(w, r, orgID, models.OrgRoleOwner) {
+		return
+	}
+
+	before, err := models.FindOrganizationById(r.Context(), s.db, orgID)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var org models.Organization
+	err = json.NewDecoder(r.Body).Decode(&org)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	org.Id = orgID
+
+	err = s.Validator.ValidateOrganization(r.Context(), org)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = models.UpdateOrganization(r.Context(), s.db, org)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := models.FindOrganizationById(r.Context(), s.db, orgID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceOrganization, orgID, before, after)
+
+	responses.Json(w, http.StatusOK, after)
+}
+
+// DeleteOrganization deletes an organization by its id. Organizations hosting
+// events can't be deleted. Only editors and administrators can delete
+// organizations.
+func (s *Server) DeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	if !requireEditor(w, r) {
+		return
+	}
+
+	orgID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericOrganizationId)
+		return
+	}
+
+	before, err := models.FindOrganizationById(r.Context(), s.db, orgID)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = models.DeleteOrganization(r.Context(), s.db, orgID)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, models.ErrOrganizationInUse) {
+		responses.Error(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionDelete, models.AuditResourceOrganization, orgID, before, nil)
+
+	responses.Json(w, http.StatusNoContent, nil)
+}
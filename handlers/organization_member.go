@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/mailer"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+var (
+	errNonNumericMemberId = errors.New("user id must be an integer")
+	errInvalidOrgRole     = fmt.Errorf("role must be one of %s", strings.Join(models.OrgRoles, ", "))
+	errInvalidInviteEmail = errors.New("email must be a valid email address")
+)
+
+// organizationMemberParams parses the organization and user ids of member
+// routes.
+func organizationMemberParams(r *http.Request) (orgId, userId int, err error) {
+	params := mux.Vars(r)
+
+	orgId, err = strconv.Atoi(params["id"])
+	if err != nil {
+		return 0, 0, errNonNumericOrganizationId
+	}
+
+	userId, err = strconv.Atoi(params["user_id"])
+	if err != nil {
+		return 0, 0, errNonNumericMemberId
+	}
+
+	return orgId, userId, nil
+}
+
+// ListOrganizationMembers lists the members of an organization. Only editors
+// and the organization's members can list them.
+func (s *Server) ListOrganizationMembers(w http.ResponseWriter, r *http.Request) {
+	orgID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericOrganizationId)
+		return
+	}
+
+	if !s.requireOrganizationRole(w, r, orgID, models.OrgRoles...) {
+		return
+	}
+
+	members, err := models.FindOrganizationMembers(r.Context(), s.db, orgID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusOK, members)
+}
+
+// InviteOrganizationMember emails an invitation to join an organization with
+// the given role. Only editors and the organization's owners can invite
+// members.
+func (s *Server) InviteOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	orgID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errNonNumericOrganizationId)
+		return
+	}
+
+	if !s.requireOrganizationRole(w, r, orgID, models.OrgRoleOwner) {
+		return
+	}
+
+	org, err := models.FindOrganizationById(r.Context(), s.db, orgID)
+	if errors.Is(err, models.ErrOrganizationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var inv models.OrganizationInvitation
+	err = json.NewDecoder(r.Body).Decode(&inv)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	addr, err := mail.ParseAddress(inv.Email)
+	if err != nil || len(addr.Address) > 100 {
+		responses.Error(w, http.StatusBadRequest, errInvalidInviteEmail)
+		return
+	}
+	inv.Email = addr.Address
+
+	if !slices.Contains(models.OrgRoles, inv.Role) {
+		responses.Error(w, http.StatusBadRequest, errInvalidOrgRole)
+		return
+	}
+
+	inv.OrganizationId = orgID
+	inv.InvitedBy = currentUserId(r)
+
+	token, tokenHash, err := models.NewInvitationToken()
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	invID, err := models.InsertOrganizationInvitation(r.Context(), s.db, inv, tokenHash)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = s.Mailer.Send(r.Context(), mailer.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("You're invited to join %s on SOMOS", org.Name),
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\nAccept the invitation at %s%s\n\nThe invitation expires in %d days.",
+			org.Name, inv.Role, s.InvitationURL, token, int(models.InvitationTTL.Hours()/24)),
+	})
+	if err != nil {
+		responses.Error(w, http.StatusBadGateway, fmt.Errorf("failed to send invitation: %w", err))
+		return
+	}
+
+	created, err := models.FindOrganizationInvitationById(r.Context(), s.db, invID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionCreate, models.AuditResourceInvitation, invID, nil, created)
+
+	responses.Json(w, http.StatusCreated, created)
+}
+
+// AcceptOrganizationInvitation makes the user making the request a member of
+// the organization they were invited to. The invitation must have been sent
+// to the user's email address.
+func (s *Server) AcceptOrganizationInvitation(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	tokenHash := models.HashInvitationToken(mux.Vars(r)["token"])
+
+	inv, err := models.AcceptOrganizationInvitation(r.Context(), s.db, tokenHash, user)
+	if errors.Is(err, models.ErrInvitationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, models.ErrInvitationEmailMismatch) {
+		responses.Error(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionCreate, models.AuditResourceOrganizationMember, inv.OrganizationId,
+		nil, map[string]any{"organization_id": inv.OrganizationId, "user_id": user.ID, "role": inv.Role})
+
+	responses.Json(w, http.StatusOK, inv)
+}
+
+// UpdateOrganizationMember changes the role of an organization member. Only
+// editors and the organization's owners can change roles.
+func (s *Server) UpdateOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, err := organizationMemberParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !s.requireOrganizationRole(w, r, orgID, models.OrgRoleOwner) {
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !slices.Contains(models.OrgRoles, body.Role) {
+		responses.Error(w, http.StatusBadRequest, errInvalidOrgRole)
+		return
+	}
+
+	roles, err := models.FindOrganizationRoles(r.Context(), s.db, userID, []int{orgID})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = models.UpdateOrganizationMember(r.Context(), s.db, orgID, userID, body.Role)
+	if errors.Is(err, models.ErrMemberNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, models.ErrLastOwner) {
+		responses.Error(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	member := map[string]any{"organization_id": orgID, "user_id": userID, "role": body.Role}
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceOrganizationMember, orgID,
+		map[string]any{"organization_id": orgID, "user_id": userID, "role": roles[orgID]}, member)
+
+	responses.Json(w, http.StatusOK, member)
+}
+
+// RemoveOrganizationMember removes a member from an organization. Editors and
+// the organization's owners can remove anyone, and members can remove
+// themselves.
+func (s *Server) RemoveOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, err := organizationMemberParams(r)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	if user.ID != userID && !s.requireOrganizationRole(w, r, orgID, models.OrgRoleOwner) {
+		return
+	}
+
+	roles, err := models.FindOrganizationRoles(r.Context(), s.db, userID, []int{orgID})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = models.RemoveOrganizationMember(r.Context(), s.db, orgID, userID)
+	if errors.Is(err, models.ErrMemberNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, models.ErrLastOwner) {
+		responses.Error(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionDelete, models.AuditResourceOrganizationMember, orgID,
+		map[string]any{"organization_id": orgID, "user_id": userID, "role": roles[orgID]}, nil)
+
+	responses.Json(w, http.StatusNoContent, nil)
+}
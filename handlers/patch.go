@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+var errUnsupportedPatch = errors.New("PATCH body must be a JSON merge patch (" + mergePatchContentType + ")")
+
+// isMergePatch reports whether the request body is a JSON merge patch. Plain
+// JSON bodies are treated as merge patches too, since that's what clients
+// sent before merge patches were supported.
+func isMergePatch(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == mergePatchContentType || mediaType == "application/json"
+}
+
+// applyMergePatch applies the RFC 7396 JSON merge patch to the JSON encoding of
+// target and decodes the result into dst. Fields left out of the patch keep
+// their value and fields set to null are cleared.
+func applyMergePatch(target any, patch []byte, dst any) error {
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	var targetVal, patchVal any
+	if err := json.Unmarshal(doc, &targetVal); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(patch, &patchVal); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(targetVal, patchVal))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(merged, dst)
+}
+
+// mergePatch implements the MergePatch function from RFC 7396 section 2 on
+// decoded JSON values.
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+
+	for key, val := range patchObj {
+		if val == nil {
+			delete(targetObj, key)
+			continue
+		}
+
+		targetObj[key] = mergePatch(targetObj[key], val)
+	}
+
+	return targetObj
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/models"
+	"github.com/somos831/somos-backend/responses"
+)
+
+// RegisterForEvent registers the user making the request to attend an event.
+func (s *Server) RegisterForEvent(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		err = errors.Join(errNonNumericEventId, err)
+		responses.Error(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	event, err := models.FindEventById(r.Context(), s.db, eventId, false)
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+
+	registered, err := models.RegisterForEvent(r.Context(), s.db, eventId, user.ID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if registered {
+		s.audit(r, models.AuditActionCreate, models.AuditResourceRegistration, eventId,
+			nil, map[string]int{"event_id": eventId, "user_id": user.ID})
+		s.Metrics.EventRegistrations.Inc()
+	}
+
+	// Registered attendees get to see how to join online.
+	if err := s.prepareEvents(r, event); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.Json(w, http.StatusCreated, event)
+}
+
+// UnregisterFromEvent cancels the registration of the user making the request
+// for an event.
+func (s *Server) UnregisterFromEvent(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user == nil {
+		responses.Error(w, http.StatusUnauthorized, errNotAuthenticated)
+		return
+	}
+
+	eventId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		err = errors.Join(errNonNumericEventId, err)
+		responses.Error(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	err = models.UnregisterFromEvent(r.Context(), s.db, eventId, user.ID)
+	if errors.Is(err, models.ErrRegistrationNotFound) {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.audit(r, models.AuditActionDelete, models.AuditResourceRegistration, eventId,
+		map[string]int{"event_id": eventId, "user_id": user.ID}, nil)
+	s.Metrics.EventUnregistrations.Inc()
+
+	responses.Json(w, http.StatusNoContent, nil)
+}
+
+// hideOnlineAccess removes the details needed to join events online unless
+// the user making the request is registered for them, is an editor or manages
+// one of their hosts.
+func (s *Server) hideOnlineAccess(r *http.Request, events ...*models.Event) error {
+	user := currentUser(r)
+	if user != nil && user.IsEditor() {
+		return nil
+	}
+
+	eventIds := []int{}
+	orgIds := []int{}
+	for _, event := range events {
+		if event.IsOnline() {
+			eventIds = append(eventIds, event.Id)
+			orgIds = append(orgIds, hostIds(event)...)
+		}
+	}
+
+	registered := map[int]bool{}
+	orgRoles := map[int]string{}
+	if user != nil {
+		var err error
+		registered, err = models.FindRegisteredEventIds(r.Context(), s.db, user.ID, eventIds)
+		if err != nil {
+			return err
+		}
+
+		orgRoles, err = models.FindOrganizationRoles(r.Context(), s.db, user.ID, orgIds)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		if registered[event.Id] {
+			continue
+		}
+
+		if managesAnyHost(event, orgRoles) {
+			continue
+		}
+
+		event.HideOnlineAccess()
+	}
+
+	return nil
+}
@@ -1,18 +1,75 @@
 package handlers
 
+import (
+	"net/http"
+	"strings"
+
+	"github.com/somos831/somos-backend/storage"
+)
+
 func (s *Server) InitRoutes() {
 	s.Router.HandleFunc("/events", s.ListEvents).Methods("GET")
 	s.Router.HandleFunc("/events/{id}", s.GetEvent).Methods("GET")
 	s.Router.HandleFunc("/events", s.CreateEvent).Methods("POST")
 	s.Router.HandleFunc("/events/{id}", s.UpdateEvent).Methods("PATCH")
 	s.Router.HandleFunc("/events/{id}", s.DeleteEvent).Methods("DELETE")
+	s.Router.HandleFunc("/events/{id}/restore", s.RestoreEvent).Methods("POST")
+	s.Router.HandleFunc("/events/{id}/registration", s.RegisterForEvent).Methods("POST")
+	s.Router.HandleFunc("/events/{id}/registration", s.UnregisterFromEvent).Methods("DELETE")
+	s.Router.HandleFunc("/events/{id}/images", s.ListEventImages).Methods("GET")
+	s.Router.HandleFunc("/events/{id}/images", s.AddEventImage).Methods("POST")
+	s.Router.HandleFunc("/events/{id}/images/order", s.ReorderEventImages).Methods("PUT")
+	s.Router.HandleFunc("/events/{id}/images/{image_id:[0-9]+}", s.UpdateEventImage).Methods("PUT")
+	s.Router.HandleFunc("/events/{id}/images/{image_id:[0-9]+}", s.RemoveEventImage).Methods("DELETE")
+	s.Router.HandleFunc("/events/{id}/images/{image_id:[0-9]+}/approve", s.ApproveEventImage).Methods("POST")
+	s.Router.HandleFunc("/events/{id}/revisions", s.ListEventRevisions).Methods("GET")
+	s.Router.HandleFunc("/events/{id}/revisions/diff", s.DiffEventRevisions).Methods("GET")
+	s.Router.HandleFunc("/events/{id}/revisions/{revision:[0-9]+}", s.GetEventRevision).Methods("GET")
+	s.Router.HandleFunc("/events/{id}/revisions/{revision:[0-9]+}/rollback", s.RollbackEvent).Methods("POST")
 
 	s.Router.HandleFunc("/categories", s.ListAllCategories).Methods("GET")
 
+	s.Router.HandleFunc("/locations", s.ListLocations).Methods("GET")
+	s.Router.HandleFunc("/locations/{id}", s.GetLocation).Methods("GET")
 	s.Router.HandleFunc("/locations", s.CreateLocation).Methods("POST")
+	s.Router.HandleFunc("/locations/{id}", s.UpdateLocation).Methods("PUT")
+	s.Router.HandleFunc("/locations/{id}", s.DeleteLocation).Methods("DELETE")
+	s.Router.HandleFunc("/locations/{id}/restore", s.RestoreLocation).Methods("POST")
+	s.Router.HandleFunc("/locations/{id}/merge", s.MergeLocations).Methods("POST")
+
+	s.Router.HandleFunc("/organizations", s.ListOrganizations).Methods("GET")
+	s.Router.HandleFunc("/organizations/{id}", s.GetOrganization).Methods("GET")
+	s.Router.HandleFunc("/organizations/{id}/events", s.ListOrganizationEvents).Methods("GET")
+	s.Router.HandleFunc("/organizations", s.CreateOrganization).Methods("POST")
+	s.Router.HandleFunc("/organizations/{id}", s.UpdateOrganization).Methods("PUT")
+	s.Router.HandleFunc("/organizations/{id}", s.DeleteOrganization).Methods("DELETE")
+	s.Router.HandleFunc("/organizations/{id}/members", s.ListOrganizationMembers).Methods("GET")
+	s.Router.HandleFunc("/organizations/{id}/members/{user_id}", s.UpdateOrganizationMember).Methods("PUT")
+	s.Router.HandleFunc("/organizations/{id}/members/{user_id}", s.RemoveOrganizationMember).Methods("DELETE")
+	s.Router.HandleFunc("/organizations/{id}/invitations", s.InviteOrganizationMember).Methods("POST")
+	s.Router.HandleFunc("/invitations/{token}/accept", s.AcceptOrganizationInvitation).Methods("POST")
+
+	s.Router.HandleFunc("/images", s.UploadImage).Methods("POST")
+	s.Router.HandleFunc("/images/{id}", s.GetImage).Methods("GET")
+
+	// Files uploaded to local storage are served from its base URL.
+	if local, ok := s.Storage.(*storage.Local); ok && strings.HasPrefix(local.BaseURL, "/") {
+		s.Router.PathPrefix(local.BaseURL+"/").
+			Handler(http.StripPrefix(local.BaseURL, local.Handler())).
+			Methods("GET", "HEAD")
+	}
 
 	s.Router.HandleFunc("/users", s.CreateUser).Methods("POST")
 	s.Router.HandleFunc("/users/{id}", s.GetUserByID).Methods("GET")
 	s.Router.HandleFunc("/users/{id}", s.DeleteUser).Methods("DELETE")
 	s.Router.HandleFunc("/users/{id}", s.UpdateUser).Methods("PUT")
+	s.Router.HandleFunc("/users/{id}/restore", s.RestoreUser).Methods("POST")
+	s.Router.HandleFunc("/users/{id}/avatar", s.GetUserAvatar).Methods("GET")
+	s.Router.HandleFunc("/users/{id}/avatar", s.PutUserAvatar).Methods("PUT")
+	s.Router.HandleFunc("/users/{id}/avatar", s.DeleteUserAvatar).Methods("DELETE")
+
+	s.Router.HandleFunc("/admin/audit", s.ListAuditEntries).Methods("GET")
+
+	s.Router.HandleFunc("/healthz", s.Healthz).Methods("GET")
+	s.Router.HandleFunc("/readyz", s.Readyz).Methods("GET")
 }
@@ -1,66 +1,383 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
+	"github.com/somos831/somos-backend/config"
 	conn "github.com/somos831/somos-backend/db"
+	"github.com/somos831/somos-backend/geocoding"
+	"github.com/somos831/somos-backend/logging"
+	"github.com/somos831/somos-backend/mailer"
+	"github.com/somos831/somos-backend/metrics"
+	"github.com/somos831/somos-backend/responses"
+	"github.com/somos831/somos-backend/storage"
+	"github.com/somos831/somos-backend/tracing"
 	"github.com/somos831/somos-backend/validators"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 type Server struct {
-	db        *sql.DB
+	db *sql.DB
+	// Config is the configuration the server was initialized with.
+	Config    *config.Config
 	Router    *mux.Router
 	Validator validators.Validator
+	// Geocoder looks up the coordinates of location addresses. Locations
+	// are saved without coordinates when it is nil.
+	Geocoder geocoding.Geocoder
+	// Mailer sends emails such as organization invitations.
+	Mailer mailer.Mailer
+	// InvitationURL is the address of the page accepting organization
+	// invitations, the invitation token is appended to it.
+	InvitationURL string
+	// PhotoSubmissions lets members who don't manage an event submit photos
+	// to its gallery, pending an editor's approval. Otherwise only editors
+	// and the event's managers add photos.
+	PhotoSubmissions bool
+	// TrustedProxies are the proxies whose X-Forwarded-For header is trusted
+	// to tell the client's address.
+	TrustedProxies []netip.Prefix
+	// Storage keeps uploaded images. Uploads are refused when it is nil.
+	Storage storage.Storage
+	// Metrics collects the metrics served at /metrics on the metrics
+	// address.
+	Metrics *metrics.Metrics
+	// shutdownTracing flushes the spans not exported yet.
+	shutdownTracing func(context.Context) error
+	// shuttingDown is set once the server starts shutting down, making it
+	// report that it isn't ready.
+	shuttingDown atomic.Bool
+	// requests counts the requests being handled, so that the database is
+	// only closed once they are done.
+	requests inFlight
 }
 
-func (server *Server) InitServer() {
+// tracingFlushTimeout bounds how long pending spans are flushed for when the
+// server stops.
+const tracingFlushTimeout = 5 * time.Second
 
-	err := godotenv.Load()
+var errShuttingDown = errors.New("server is shutting down")
+
+// inFlight counts requests being handled. Once closed it refuses new ones, so
+// that none can start while the counted ones are waited for.
+type inFlight struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// start counts a new request, unless closed. done must be called once it is
+// handled.
+func (f *inFlight) start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return false
+	}
+	f.wg.Add(1)
+
+	return true
+}
+
+func (f *inFlight) done() {
+	f.wg.Done()
+}
+
+// closeAndWait refuses new requests and waits for those counted.
+func (f *inFlight) closeAndWait() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+
+	f.wg.Wait()
+}
+
+// InitServer connects to the database and sets up the server and its
+// dependencies as configured by cfg.
+func (server *Server) InitServer(cfg *config.Config) {
+	server.Config = cfg
+
+	// Initialize logging, before anything that logs:
+	err := logging.Setup(cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	db := conn.Connect()
+	// Initialize tracing, before anything that is traced:
+	server.shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := ConnectDB(cfg.Database)
 	server.db = db
 
+	// Initialize metrics, before routes since they are recorded by the
+	// server's middleware:
+	server.Metrics = metrics.New()
+	server.Metrics.CollectDB(db, cfg.Database.Name)
+
 	// Initialize new router:
 	server.Router = mux.NewRouter()
-	server.Router.Use(ContextMiddleware)
+	server.Router.Use(otelmux.Middleware(tracing.ServiceName,
+		otelmux.WithFilter(func(r *http.Request) bool { return !isProbe(r) }),
+	))
+	server.Router.Use(ContextMiddleware(cfg.HTTP.RequestTimeout))
+	server.Router.Use(server.UserMiddleware)
+
+	// Initialize storage, before routes since local uploads are served by
+	// the server itself. Uploads are refused without storage:
+	if cfg.Features.Uploads {
+		server.Storage, err = NewStorage(cfg.Storage)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Initialize routes:
 	server.InitRoutes()
 
 	// Initialize validator:
 	server.Validator = validators.NewValidator(db)
+
+	// Initialize geocoder:
+	if cfg.Geocoder.URL != "" {
+		server.Geocoder = geocoding.NewNominatim(cfg.Geocoder.URL, cfg.Geocoder.UserAgent)
+	}
+
+	// Initialize mailer, emails are only logged without an SMTP server:
+	server.Mailer = mailer.Log{}
+	if cfg.SMTP.Addr != "" {
+		server.Mailer = &mailer.SMTP{
+			Addr:     cfg.SMTP.Addr,
+			From:     cfg.SMTP.From,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+		}
+	}
+	server.InvitationURL = cfg.InvitationURL
+	server.PhotoSubmissions = cfg.Features.PhotoSubmissions
+
+	// Initialize the proxies trusted to tell the client's address:
+	for _, proxy := range cfg.HTTP.TrustedProxies {
+		prefix, err := config.ParsePrefix(proxy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.TrustedProxies = append(server.TrustedProxies, prefix)
+	}
+}
+
+// ConnectDB connects to the database configured by cfg, exiting when it can't
+// be reached.
+func ConnectDB(cfg config.Database) *sql.DB {
+	dsn := conn.DSN(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name)
+
+	return conn.Connect(dsn, conn.Pool{
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+	})
+}
+
+// NewStorage returns the storage configured by cfg.
+func NewStorage(cfg config.Storage) (storage.Storage, error) {
+	switch cfg.Backend {
+	case "local":
+		return storage.NewLocal(cfg.UploadsDir, cfg.UploadsURL)
+	case "s3":
+		return storage.NewS3(
+			cfg.S3.Endpoint,
+			cfg.S3.Region,
+			cfg.S3.Bucket,
+			cfg.S3.AccessKeyId,
+			cfg.S3.SecretAccessKey,
+			cfg.S3.PublicURL,
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, expected local or s3", cfg.Backend)
+	}
+}
+
+// Handler returns the handler serving the API. Unlike the router's own
+// middlewares, which only run for matching routes, it gives every request an
+// id, an access log line and metrics, and counts it until it is handled.
+func (server *Server) Handler() http.Handler {
+	handler := RequestIdMiddleware(AccessLogMiddleware(server.MetricsMiddleware(server.Router)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Connections closed on shutdown may still be delivering requests
+		// after the server stopped waiting for them.
+		if !server.requests.start() {
+			w.Header().Set("Connection", "close")
+			responses.Error(w, http.StatusServiceUnavailable, errShuttingDown)
+			return
+		}
+		defer server.requests.done()
+
+		handler.ServeHTTP(w, r)
+	})
 }
 
+// MetricsHandler returns the handler serving metrics, meant for the metrics
+// address rather than the API's.
+func (server *Server) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", server.Metrics.Handler())
+
+	return mux
+}
+
+// Run serves the API on addr until the process is interrupted or terminated,
+// then shuts down gracefully.
 func (server *Server) Run(addr string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	go func() {
-		// Handle termination signals
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.Info("listening", "addr", ln.Addr().String())
+
+	if err := server.Serve(ctx, ln); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Serve serves the API on ln, along with the metrics on their own address when
+// configured and the background workers, until ctx is done. It then shuts
+// down gracefully:
+//
+//  1. The server reports that it isn't ready and, after the configured
+//     shutdown delay, stops accepting connections.
+//  2. Requests being served are given the shutdown timeout to complete, after
+//     which their contexts are canceled, their connections closed and their
+//     handlers waited for.
+//  3. Background workers are stopped and waited for.
+//  4. Pending spans are flushed and the database is closed last, once nothing
+//     uses it anymore.
+func (server *Server) Serve(ctx context.Context, ln net.Listener) error {
+	cfg := server.Config.HTTP
+	httpServer := &http.Server{
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
 
-		// Block until a signal is received
-		<-sigint
+	// Requests are canceled through their base context when they don't
+	// complete in time on shutdown.
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	httpServer.BaseContext = func(net.Listener) context.Context { return requestsCtx }
+
+	if addr := server.Config.MetricsAddr; addr != "" {
+		metricsLn, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for metrics: %w", err)
+		}
+
+		metricsServer := &http.Server{
+			Handler:           server.MetricsHandler(),
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ErrorLog:          httpServer.ErrorLog,
+		}
+		defer metricsServer.Close()
+
+		slog.Info("serving metrics", "addr", metricsLn.Addr().String())
+		go func() {
+			err := metricsServer.Serve(metricsLn)
+			if !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("failed to serve metrics", "error", err)
+			}
+		}()
+	}
 
-		// Shutdown gracefully
-		log.Println("Shutting down server...")
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
 
-		// Perform cleanup tasks before exiting
-		conn.Disconnect(server.db)
+	var workers sync.WaitGroup
+	if gc := server.Config.ImageGC; server.Storage != nil && gc.Interval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			server.sweepImages(workersCtx, gc.Interval, gc.Grace)
+		}()
+	}
 
-		// Exit
-		os.Exit(0)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(ln)
 	}()
 
-	log.Printf("Listening on port %s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, server.Router))
+	select {
+	case err := <-serveErr:
+		stopWorkers()
+		workers.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+	server.shuttingDown.Store(true)
+
+	// Give load balancers time to notice that the server isn't ready.
+	time.Sleep(cfg.ShutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := httpServer.Shutdown(drainCtx)
+	if err != nil {
+		slog.Error("requests didn't complete in time, canceling them", "error", err)
+		cancelRequests()
+		httpServer.Close()
+	}
+
+	// Closing connections doesn't stop their handlers, which may still be
+	// using the database.
+	server.requests.closeAndWait()
+
+	stopWorkers()
+	workers.Wait()
+
+	if server.shutdownTracing != nil {
+		// The drain context may have expired already.
+		flushCtx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+
+		if err := server.shutdownTracing(flushCtx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}
+
+	if server.db != nil {
+		if err := server.db.Close(); err != nil {
+			slog.Error("failed to close database", "error", err)
+		}
+	}
+
+	slog.Info("server stopped")
+
+	return nil
 }
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/config"
+	"github.com/somos831/somos-backend/metrics"
+)
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.ShutdownDelay = 500 * time.Millisecond
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	s := &Server{
+		db:      newFakeDB(t, nil),
+		Config:  &cfg,
+		Router:  mux.NewRouter(),
+		Metrics: metrics.New(),
+	}
+	s.Router.HandleFunc("/readyz", s.Readyz).Methods("GET")
+	s.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}).Methods("GET")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx, ln)
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow request never reached its handler")
+	}
+
+	cancel()
+
+	// The server keeps serving during the shutdown delay, reporting that it
+	// is shutting down.
+	readiness := ""
+	deadline := time.Now().Add(cfg.HTTP.ShutdownDelay)
+	for readiness != healthShuttingDown && time.Now().Before(deadline) {
+		readiness = readyzStatus(t, baseURL)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if readiness != healthShuttingDown {
+		t.Errorf("/readyz status = %q during the shutdown delay, want %q", readiness, healthShuttingDown)
+	}
+
+	// Past the delay, the server waits for the slow request.
+	time.Sleep(cfg.HTTP.ShutdownDelay)
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned %v while a request was being handled", err)
+	default:
+	}
+
+	close(release)
+
+	select {
+	case res := <-slow:
+		if res.err != nil {
+			t.Fatalf("slow request: %v", res.err)
+		}
+		if res.status != http.StatusOK || res.body != "done" {
+			t.Errorf("slow request = %d %q, want 200 \"done\"", res.status, res.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow request never completed")
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve never returned")
+	}
+}
+
+func TestServeWaitsForCanceledRequests(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.ShutdownTimeout = 100 * time.Millisecond
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+
+	s := &Server{
+		db:      newFakeDB(t, nil),
+		Config:  &cfg,
+		Router:  mux.NewRouter(),
+		Metrics: metrics.New(),
+	}
+	s.Router.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		// Cleaning up after the cancellation, such as rolling back a
+		// transaction, still needs the database.
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	}).Methods("GET")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx, ln)
+	}()
+
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stuck request never reached its handler")
+	}
+
+	cancel()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve never returned")
+	}
+
+	if !finished.Load() {
+		t.Error("Serve returned before the canceled request's handler")
+	}
+}
+
+// readyzStatus returns the status reported by /readyz, or "" when it can't be
+// reached.
+func readyzStatus(t *testing.T, baseURL string) string {
+	t.Helper()
+
+	resp, err := http.Get(baseURL + "/readyz")
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var res readiness
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Errorf("/readyz: %v", err)
+		return ""
+	}
+
+	return res.Status
+}
+
+func TestInFlightRefusesRequestsOnceClosed(t *testing.T) {
+	var requests inFlight
+	if !requests.start() {
+		t.Fatal("start refused a request before closing")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		requests.closeAndWait()
+		close(waited)
+	}()
+
+	// Requests arriving while the counted one is waited for are refused.
+	for deadline := time.Now().Add(time.Second); ; {
+		if !requests.start() {
+			break
+		}
+		requests.done()
+		if time.Now().After(deadline) {
+			t.Fatal("start still counts requests after closing")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-waited:
+		t.Fatal("closeAndWait returned before the counted request was done")
+	default:
+	}
+
+	requests.done()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closeAndWait never returned")
+	}
+}
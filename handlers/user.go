@@ -12,10 +12,13 @@ import (
 )
 
 var (
-	UserNotFoundErr = errors.New("user not found")
+	UserNotFoundErr = models.ErrUserNotFound
+
+	errRoleOrStatusChange = errors.New("only administrators can change a user's role or status")
 )
 
-// Create User: Endpoint for creating a new user account.
+// Create User: Endpoint for creating a new user account. Users signing up
+// get the member role, only administrators choose another one.
 func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Parse JSON request body into a User struct
@@ -27,6 +30,10 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user := currentUser(r); user == nil || !user.IsAdmin() {
+		newUser.RoleID = models.RoleMember
+	}
+
 	err = s.Validator.ValidateNewUser(r.Context(), newUser)
 	if err != nil {
 		responses.Error(w, http.StatusBadRequest, err)
@@ -40,6 +47,10 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	newUser.ID = userID
+	s.audit(r, models.AuditActionCreate, models.AuditResourceUser, userID, nil, newUser)
+	s.Metrics.UsersCreated.Inc()
+
 	// Return the ID of the newly created user in the response
 	jsonResponse := map[string]int{"user_id": userID}
 	responses.Json(w, http.StatusCreated, jsonResponse)
@@ -56,7 +67,12 @@ func (s *Server) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	foundUser, err := models.FindUserByID(r.Context(), s.db, userID)
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	foundUser, err := models.FindUserByID(r.Context(), s.db, userID, withDeleted)
 
 	if errors.Is(err, UserNotFoundErr) {
 		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
@@ -67,10 +83,17 @@ func (s *Server) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.prepareUsers(r, foundUser); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, foundUser.Version)
 	responses.Json(w, http.StatusFound, foundUser)
 }
 
-// UpdateUser: Endpoint for updating user information.
+// UpdateUser: Endpoint for updating user information. Users update their own
+// account, only administrators update others or change roles and statuses.
 func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
@@ -81,15 +104,40 @@ func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+
+	before, err := models.FindUserByID(r.Context(), s.db, userID, false)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to update user"))
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, before.Version)
+	if !ok {
+		return
+	}
+
 	var user models.User
 	err = json.NewDecoder(r.Body).Decode(&user)
 	user.ID = userID
+	user.Version = version
 
 	if err != nil {
 		responses.Error(w, http.StatusBadRequest, errors.New("failed to decode request body"))
 		return
 	}
 
+	if (user.RoleID != before.RoleID || user.StatusID != before.StatusID) && !currentUser(r).IsAdmin() {
+		responses.Error(w, http.StatusForbidden, errRoleOrStatusChange)
+		return
+	}
+
 	err = s.Validator.ValidateUpdatedFields(r.Context(), user)
 	if errors.Is(err, UserNotFoundErr) {
 		responses.Error(w, http.StatusNotFound, errors.New("user with given ID does not exist"))
@@ -101,15 +149,34 @@ func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = models.UpdateUser(r.Context(), s.db, &user)
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, errors.New("failed to update user"))
 		return
 	}
 
-	responses.Json(w, http.StatusOK, user)
+	after, err := models.FindUserByID(r.Context(), s.db, userID, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	s.audit(r, models.AuditActionUpdate, models.AuditResourceUser, userID, before, after)
+
+	if err := s.prepareUsers(r, after); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, after.Version)
+	responses.Json(w, http.StatusOK, after)
 }
 
-// Delete User: Endpoint for deleting a user account.
+// Delete User: Endpoint for deleting a user account, by the user themselves
+// or an administrator.
 func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
@@ -120,7 +187,11 @@ func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := models.FindUserByID(r.Context(), s.db, userID)
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+
+	user, err := models.FindUserByID(r.Context(), s.db, userID, false)
 
 	if errors.Is(err, UserNotFoundErr) {
 		responses.Error(w, http.StatusNotFound, errors.New("user with given ID was not found"))
@@ -131,11 +202,80 @@ func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = models.DeleteUser(r.Context(), s.db, user.ID)
+	version, ok := ifMatchVersion(w, r, user.Version)
+	if !ok {
+		return
+	}
+
+	err = models.DeleteUser(r.Context(), s.db, user.ID, version)
+	if errors.Is(err, models.ErrVersionMismatch) {
+		responses.Error(w, http.StatusPreconditionFailed, errStaleETag)
+		return
+	}
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, errors.New("failed to delete user"))
 		return
 	}
 
+	deleted, err := models.FindUserByID(r.Context(), s.db, user.ID, true)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	s.audit(r, models.AuditActionDelete, models.AuditResourceUser, user.ID, user, deleted)
+
 	responses.Json(w, http.StatusNoContent, nil)
 }
+
+// Restore User: Endpoint for restoring a soft-deleted user account.
+func (s *Server) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	params := mux.Vars(r)
+	id := params["id"]
+
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, errors.New("user ID must be an integer value"))
+		return
+	}
+
+	before, err := models.FindUserByID(r.Context(), s.db, userID, true)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("no deleted user with given ID"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to restore user"))
+		return
+	}
+
+	err = models.RestoreUser(r.Context(), s.db, userID)
+	if errors.Is(err, UserNotFoundErr) {
+		responses.Error(w, http.StatusNotFound, errors.New("no deleted user with given ID"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to restore user"))
+		return
+	}
+
+	user, err := models.FindUserByID(r.Context(), s.db, userID, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	s.audit(r, models.AuditActionRestore, models.AuditResourceUser, userID, before, user)
+
+	if err := s.prepareUsers(r, user); err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, user.Version)
+	responses.Json(w, http.StatusOK, user)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/somos831/somos-backend/models"
+)
+
+// requestAs returns a request for the user with the route variables vars, an
+// anonymous one when user is nil.
+func requestAs(user *models.User, method, body string, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	r = mux.SetURLVars(r, vars)
+	if user != nil {
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+	}
+
+	return r
+}
+
+func TestUserChangesRequireSelfOrAdmin(t *testing.T) {
+	member := &models.User{ID: 7, RoleID: models.RoleMember}
+	editor := &models.User{ID: 8, RoleID: models.RoleEditor}
+
+	s := &Server{}
+	handlers := map[string]http.HandlerFunc{
+		http.MethodPut:    s.UpdateUser,
+		http.MethodDelete: s.DeleteUser,
+	}
+
+	tests := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "another member", user: member, want: http.StatusForbidden},
+		{name: "editor", user: editor, want: http.StatusForbidden},
+	}
+
+	for method, handler := range handlers {
+		for _, test := range tests {
+			t.Run(method+" by "+test.name, func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				handler(rec, requestAs(test.user, method, `{"role_id": 1}`, map[string]string{"id": "1"}))
+
+				if rec.Code != test.want {
+					t.Errorf("code = %d, want %d", rec.Code, test.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package imaging
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// AvatarSize is the largest size avatars are stored at. Avatars are cropped
+// to a square.
+const AvatarSize = 512
+
+// AvatarSpecs are the variants generated for avatars.
+var AvatarSpecs = []Spec{
+	{Name: "small", Width: 64, Height: 64},
+	{Name: "medium", Width: 256, Height: 256},
+}
+
+// avatarColors are the backgrounds of generated avatars. White text is
+// readable on all of them.
+var avatarColors = []string{
+	"#1e6091", "#168aad", "#2a9d8f", "#3a7d44", "#6a4c93",
+	"#9d4edd", "#c2185b", "#d1495b", "#b5651d", "#5c677d",
+}
+
+// Initials returns up to two uppercase initials for a user, from their first
+// and last name or else from their username.
+func Initials(firstName, lastName, username string) string {
+	initials := ""
+	for _, name := range []string{firstName, lastName} {
+		for _, r := range strings.TrimSpace(name) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				initials += string(unicode.ToUpper(r))
+			}
+			break
+		}
+	}
+
+	if initials == "" {
+		for _, r := range username {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				initials = string(unicode.ToUpper(r))
+				break
+			}
+		}
+	}
+
+	if initials == "" {
+		initials = "?"
+	}
+
+	return initials
+}
+
+// InitialsSVG returns a square SVG avatar showing initials. The background
+// color is picked from seed, such as the user's id, so that it stays the same
+// for a user.
+func InitialsSVG(initials string, seed int) []byte {
+	if seed < 0 {
+		seed = -seed
+	}
+	color := avatarColors[seed%len(avatarColors)]
+
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 100 100" role="img" aria-label="%[3]s">`+
+		`<rect width="100" height="100" fill="%[2]s"/>`+
+		`<text x="50" y="50" dy=".35em" text-anchor="middle" fill="#ffffff" font-family="Helvetica, Arial, sans-serif" font-size="42" font-weight="600">%[3]s</text>`+
+		`</svg>`, AvatarSize, color, html.EscapeString(initials)))
+}
@@ -0,0 +1,240 @@
+// Package imaging generates resized variants of uploaded images.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ErrWebPUnsupported is returned by EncodeWebP when the server was built
+// without cgo, which the WebP encoder needs.
+var ErrWebPUnsupported = errors.New("imaging: webp encoding requires cgo")
+
+// jpegQuality is the quality variants are encoded with, for JPEG and WebP.
+const jpegQuality = 82
+
+// Spec describes a variant of an image.
+type Spec struct {
+	Name string
+	// Width is the width of the variant. Images narrower than Width keep
+	// their width, they are never enlarged.
+	Width int
+	// Height is only set for cropped variants, which are scaled to cover
+	// Width x Height and cropped around their center.
+	Height int
+}
+
+// Cropped reports whether the variant has a different aspect ratio than the
+// original image.
+func (s Spec) Cropped() bool {
+	return s.Height > 0
+}
+
+// Specs are the variants generated for every uploaded image.
+var Specs = []Spec{
+	{Name: "thumbnail", Width: 200, Height: 200},
+	{Name: "card", Width: 600},
+	{Name: "hero", Width: 1600},
+}
+
+// Variant is an encoded variant of an image.
+type Variant struct {
+	Name        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Decode decodes an image, turning it upright according to its EXIF
+// orientation.
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return Orient(img, Orientation(data)), nil
+}
+
+// Generate returns the variants of img described by specs. Each variant is
+// encoded as a JPEG, or a PNG when the original is a PNG or GIF to keep its
+// transparency, and also as a WebP when the WebP encoder is available.
+func Generate(img image.Image, contentType string, specs []Spec) ([]Variant, error) {
+	variants := []Variant{}
+	for _, spec := range specs {
+		resized := Resize(img, spec)
+		bounds := resized.Bounds()
+
+		var data []byte
+		var err error
+		variantType := "image/jpeg"
+		if contentType == "image/png" || contentType == "image/gif" {
+			variantType = "image/png"
+			data, err = EncodePNG(resized)
+		} else {
+			data, err = EncodeJPEG(resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, Variant{
+			Name:        spec.Name,
+			ContentType: variantType,
+			Width:       bounds.Dx(),
+			Height:      bounds.Dy(),
+			Data:        data,
+		})
+
+		webp, err := EncodeWebP(resized)
+		if errors.Is(err, ErrWebPUnsupported) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, Variant{
+			Name:        spec.Name,
+			ContentType: "image/webp",
+			Width:       bounds.Dx(),
+			Height:      bounds.Dy(),
+			Data:        webp,
+		})
+	}
+
+	return variants, nil
+}
+
+// Resize scales img down to the size described by spec.
+func Resize(img image.Image, spec Spec) image.Image {
+	src := img.Bounds()
+
+	if spec.Cropped() {
+		// Crop the largest centered area with the aspect ratio of the
+		// variant, then scale it.
+		cropW, cropH := src.Dx(), src.Dx()*spec.Height/spec.Width
+		if cropH > src.Dy() {
+			cropW, cropH = src.Dy()*spec.Width/spec.Height, src.Dy()
+		}
+		x := src.Min.X + (src.Dx()-cropW)/2
+		y := src.Min.Y + (src.Dy()-cropH)/2
+		crop := image.Rect(x, y, x+cropW, y+cropH)
+
+		w, h := spec.Width, spec.Height
+		if cropW < w {
+			w, h = cropW, cropH
+		}
+
+		return scale(img, crop, w, h)
+	}
+
+	w, h := src.Dx(), src.Dy()
+	if w > spec.Width {
+		w, h = spec.Width, max(1, h*spec.Width/w)
+	}
+
+	return scale(img, src, w, h)
+}
+
+func scale(img image.Image, src image.Rectangle, w, h int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+
+	return dst
+}
+
+// EncodeJPEG encodes img as a JPEG. Transparent areas become white.
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: jpegQuality})
+
+	return buf.Bytes(), err
+}
+
+// EncodePNG encodes img as a PNG.
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+
+	return buf.Bytes(), err
+}
+
+// Orient turns img upright according to an EXIF orientation, from 1 to 8.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 swap width and height.
+	dstBounds := image.Rect(0, 0, w, h)
+	if orientation >= 5 {
+		dstBounds = image.Rect(0, 0, h, w)
+	}
+
+	// Pixels are moved 4 bytes at a time, images with other pixel formats
+	// are converted to RGBA first.
+	var src, dst []uint8
+	var srcStride, dstStride int
+	var oriented image.Image
+	switch img := img.(type) {
+	case *image.NRGBA:
+		out := image.NewNRGBA(dstBounds)
+		src, srcStride = img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y):], img.Stride
+		dst, dstStride, oriented = out.Pix, out.Stride, out
+	case *image.RGBA:
+		out := image.NewRGBA(dstBounds)
+		src, srcStride = img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y):], img.Stride
+		dst, dstStride, oriented = out.Pix, out.Stride, out
+	default:
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+		out := image.NewRGBA(dstBounds)
+		src, srcStride = rgba.Pix, rgba.Stride
+		dst, dstStride, oriented = out.Pix, out.Stride, out
+	}
+
+	for y := 0; y < h; y++ {
+		row := src[y*srcStride:]
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counterclockwise
+				dx, dy = y, w-1-x
+			}
+
+			i := dy*dstStride + dx*4
+			copy(dst[i:i+4], row[x*4:x*4+4])
+		}
+	}
+
+	return oriented
+}
@@ -0,0 +1,83 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+var (
+	topLeft     = color.NRGBA{R: 255, A: 255}
+	topRight    = color.NRGBA{G: 255, A: 255}
+	bottomLeft  = color.NRGBA{B: 255, A: 255}
+	bottomRight = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	middle      = color.NRGBA{A: 255}
+)
+
+// cornersImage returns a 3x2 image of type like with a distinct color in each
+// corner, at offset.
+func cornersImage(like func(image.Rectangle) draw.Image, offset image.Point) image.Image {
+	bounds := image.Rect(0, 0, 3, 2).Add(offset)
+	img := like(bounds)
+	draw.Draw(img, bounds, image.NewUniform(middle), image.Point{}, draw.Src)
+
+	first, last := bounds.Min, bounds.Max.Sub(image.Pt(1, 1))
+	img.Set(first.X, first.Y, topLeft)
+	img.Set(last.X, first.Y, topRight)
+	img.Set(first.X, last.Y, bottomLeft)
+	img.Set(last.X, last.Y, bottomRight)
+
+	return img
+}
+
+func TestOrient(t *testing.T) {
+	types := map[string]func(image.Rectangle) draw.Image{
+		"nrgba":  func(r image.Rectangle) draw.Image { return image.NewNRGBA(r) },
+		"rgba":   func(r image.Rectangle) draw.Image { return image.NewRGBA(r) },
+		"rgba64": func(r image.Rectangle) draw.Image { return image.NewRGBA64(r) },
+	}
+
+	// Corners of the oriented image: top left, top right, bottom left and
+	// bottom right.
+	tests := []struct {
+		orientation int
+		width       int
+		corners     [4]color.NRGBA
+	}{
+		{1, 3, [4]color.NRGBA{topLeft, topRight, bottomLeft, bottomRight}},
+		{2, 3, [4]color.NRGBA{topRight, topLeft, bottomRight, bottomLeft}},
+		{3, 3, [4]color.NRGBA{bottomRight, bottomLeft, topRight, topLeft}},
+		{4, 3, [4]color.NRGBA{bottomLeft, bottomRight, topLeft, topRight}},
+		{5, 2, [4]color.NRGBA{topLeft, bottomLeft, topRight, bottomRight}},
+		{6, 2, [4]color.NRGBA{bottomLeft, topLeft, bottomRight, topRight}},
+		{7, 2, [4]color.NRGBA{bottomRight, topRight, bottomLeft, topLeft}},
+		{8, 2, [4]color.NRGBA{topRight, bottomRight, topLeft, bottomLeft}},
+	}
+
+	for name, like := range types {
+		for _, offset := range []image.Point{{}, {5, 7}} {
+			for _, test := range tests {
+				img := cornersImage(like, offset)
+				got := Orient(img, test.orientation)
+
+				bounds := got.Bounds()
+				if bounds.Dx() != test.width || bounds.Dy() != 5-test.width {
+					t.Errorf("%s at %v, orientation %d: size = %dx%d, want %dx%d", name, offset, test.orientation,
+						bounds.Dx(), bounds.Dy(), test.width, 5-test.width)
+					continue
+				}
+
+				first, last := bounds.Min, bounds.Max.Sub(image.Pt(1, 1))
+				corners := [4]image.Point{{first.X, first.Y}, {last.X, first.Y}, {first.X, last.Y}, {last.X, last.Y}}
+				for i, corner := range corners {
+					c := color.NRGBAModel.Convert(got.At(corner.X, corner.Y)).(color.NRGBA)
+					if c != test.corners[i] {
+						t.Errorf("%s at %v, orientation %d: pixel at %v = %v, want %v", name, offset, test.orientation,
+							corner, c, test.corners[i])
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build cgo
+
+package imaging
+
+import (
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+// EncodeWebP encodes img as a lossy WebP.
+func EncodeWebP(img image.Image) ([]byte, error) {
+	return webp.EncodeRGBA(img, jpegQuality)
+}
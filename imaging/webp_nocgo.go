@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package imaging
+
+import "image"
+
+// EncodeWebP always returns ErrWebPUnsupported, the WebP encoder needs cgo.
+func EncodeWebP(image.Image) ([]byte, error) {
+	return nil, ErrWebPUnsupported
+}
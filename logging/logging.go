@@ -0,0 +1,92 @@
+// Package logging configures structured logging and carries loggers, along
+// with the id of the request being served, through contexts.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	requestIdContextKey
+)
+
+// New returns a logger writing records of at least level to w, as JSON or,
+// with format "text", as key=value pairs.
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected json or text", format)
+	}
+}
+
+// ParseLevel parses a level such as "debug", "info", "warn" or "error". An
+// empty level is info.
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+
+	err := l.UnmarshalText([]byte(strings.ToUpper(level)))
+	return l, err
+}
+
+// Setup makes the default logger write records of at least level to stderr,
+// in format as with New. Messages written with the log package go through it
+// too.
+func Setup(level, format string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logger, err := New(os.Stderr, l, format)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// WithRequestId returns a copy of ctx carrying the id of the request being
+// served, and a logger recording it with every message.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	ctx = context.WithValue(ctx, requestIdContextKey, requestId)
+	return WithLogger(ctx, FromContext(ctx).With("request_id", requestId))
+}
+
+// RequestId returns the id of the request carried by ctx, if any.
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdContextKey).(string)
+	return requestId
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// Log writes emails to the log instead of sending them. It is used in local
+// development, when no SMTP server is configured. Only the recipient and
+// subject are logged since bodies can hold secrets, such as invitation tokens.
+type Log struct{}
+
+// Send logs the recipient and subject of msg.
+func (Log) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).Info("email", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// Memory keeps the emails it is given instead of sending them, so that they
+// can be inspected in tests.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records msg.
+func (m *Memory) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+// Messages returns the emails sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
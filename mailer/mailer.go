@@ -0,0 +1,16 @@
+// Package mailer sends transactional emails, such as organization invitations.
+package mailer
+
+import "context"
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTP sends emails through an SMTP server. Auth is optional, PLAIN
+// authentication is used when Username is set.
+type SMTP struct {
+	// Addr is the host:port of the SMTP server.
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send sends msg through the SMTP server.
+func (s *SMTP) Send(_ context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// Header values must not contain line breaks, or they could be used to
+	// inject headers.
+	for _, v := range []string{s.From, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("mailer: header value %q contains a line break", v)
+		}
+	}
+
+	body := strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	data := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.From, msg.To, msg.Subject, body)
+
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(data))
+}
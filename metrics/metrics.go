@@ -0,0 +1,130 @@
+// Package metrics collects the server's Prometheus metrics: HTTP requests,
+// the database connection pool and business events such as registrations.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "somos"
+
+// Metrics holds the collectors of a server, registered in their own
+// registry rather than the global one.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+
+	EventsCreated        prometheus.Counter
+	EventRegistrations   prometheus.Counter
+	EventUnregistrations prometheus.Counter
+	UsersCreated         prometheus.Counter
+	ImagesUploaded       prometheus.Counter
+}
+
+// New returns metrics registered along with the Go runtime and process
+// collectors.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being served.",
+		}),
+		EventsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_created_total",
+			Help:      "Events created.",
+		}),
+		EventRegistrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "event_registrations_total",
+			Help:      "Registrations to attend events.",
+		}),
+		EventUnregistrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "event_unregistrations_total",
+			Help:      "Canceled registrations to attend events.",
+		}),
+		UsersCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_created_total",
+			Help:      "Users created.",
+		}),
+		ImagesUploaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "images_uploaded_total",
+			Help:      "Images uploaded, avatars included.",
+		}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.EventsCreated,
+		m.EventRegistrations,
+		m.EventUnregistrations,
+		m.UsersCreated,
+		m.ImagesUploaded,
+	)
+
+	return m
+}
+
+// CollectDB adds the connection pool statistics of db, from db.Stats, to
+// the metrics.
+func (m *Metrics) CollectDB(db *sql.DB, dbName string) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// RequestStarted counts a request being served until the returned function
+// is called.
+func (m *Metrics) RequestStarted() (done func()) {
+	m.requestsInFlight.Inc()
+	return m.requestsInFlight.Dec
+}
+
+// ObserveRequest records a request served for route, the template of the
+// route it matched, such as "/events/{id}".
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	// Clients can send any method, keep them from adding labels without
+	// bounds.
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "other"
+	}
+
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditActionCreate   = "create"
+	AuditActionUpdate   = "update"
+	AuditActionDelete   = "delete"
+	AuditActionRestore  = "restore"
+	AuditActionRollback = "rollback"
+	AuditActionMerge    = "merge"
+)
+
+// Resource types recorded in the audit log.
+const (
+	AuditResourceEvent              = "event"
+	AuditResourceUser               = "user"
+	AuditResourceLocation           = "location"
+	AuditResourceRegistration       = "registration"
+	AuditResourceOrganization       = "organization"
+	AuditResourceOrganizationMember = "organization_member"
+	AuditResourceInvitation         = "organization_invitation"
+	AuditResourceImage              = "image"
+	AuditResourceEventImage         = "event_image"
+)
+
+// AuditEntry records a single change made through the API. Entries are
+// append-only, they are never updated or deleted.
+type AuditEntry struct {
+	Id           int64                  `json:"id"`
+	ActorId      *int                   `json:"actor_id"`
+	Action       string                 `json:"action"`
+	ResourceType string                 `json:"resource_type"`
+	ResourceId   *int                   `json:"resource_id"`
+	Changes      map[string]FieldChange `json:"changes"`
+	IP           *string                `json:"ip"`
+	RequestId    *string                `json:"request_id"`
+	CreatedAt    string                 `json:"created_at"`
+}
+
+// AuditFilter narrows down the entries returned by FindAuditEntries. Zero
+// values don't filter.
+type AuditFilter struct {
+	ActorId      *int
+	Action       string
+	ResourceType string
+	ResourceId   *int
+	Since        *time.Time
+	Until        *time.Time
+	// BeforeId only returns entries older than the entry with this id, used
+	// to page through the log.
+	BeforeId int64
+	Limit    int
+}
+
+// InsertAuditEntry appends entry to the audit log.
+func InsertAuditEntry(ctx context.Context, db *sql.DB, entry AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (
+			actor_id,
+			action,
+			resource_type,
+			resource_id,
+			changes,
+			ip,
+			request_id
+		) VALUES ( ?, ?, ?, ?, ?, ?, ? )
+	`
+	_, err = db.ExecContext(ctx, query,
+		entry.ActorId,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceId,
+		changes,
+		entry.IP,
+		entry.RequestId,
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert audit entry", "error", err, "entry", entry)
+		return err
+	}
+
+	return nil
+}
+
+// FindAuditEntries finds the audit entries matching filter, newest first.
+func FindAuditEntries(ctx context.Context, db *sql.DB, filter AuditFilter) ([]AuditEntry, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if filter.ActorId != nil {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, *filter.ActorId)
+	}
+
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+
+	if filter.ResourceType != "" {
+		conditions = append(conditions, "resource_type = ?")
+		args = append(args, filter.ResourceType)
+	}
+
+	if filter.ResourceId != nil {
+		conditions = append(conditions, "resource_id = ?")
+		args = append(args, *filter.ResourceId)
+	}
+
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.Since)
+	}
+
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, *filter.Until)
+	}
+
+	if filter.BeforeId > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeId)
+	}
+
+	query := `
+		SELECT id, actor_id, action, resource_type, resource_id, changes, ip, request_id, created_at
+		FROM audit_log
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find audit entries", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var changes []byte
+
+		err := rows.Scan(
+			&entry.Id,
+			&entry.ActorId,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceId,
+			&changes,
+			&entry.IP,
+			&entry.RequestId,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to scan audit entry", "error", err)
+			return nil, err
+		}
+
+		if changes != nil {
+			if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+				return nil, err
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over audit rows", "error", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// redactedFields are never copied into a diff.
+var redactedFields = map[string]bool{
+	"password": true,
+}
+
+const redacted = "[redacted]"
+
+// FieldChange is the value of a single field before and after a change.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff compares the JSON encodings of before and after and returns the top
+// level fields whose values differ, keyed by their JSON name. Either side may
+// be nil, which is how creations and deletions are recorded.
+func Diff(before, after any) (map[string]FieldChange, error) {
+	from, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for key, val := range from {
+		if !reflect.DeepEqual(val, to[key]) {
+			changes[key] = FieldChange{From: val, To: to[key]}
+		}
+	}
+
+	for key, val := range to {
+		if _, ok := from[key]; !ok {
+			changes[key] = FieldChange{From: nil, To: val}
+		}
+	}
+
+	for key, change := range changes {
+		if redactedFields[key] {
+			changes[key] = FieldChange{From: redactValue(change.From), To: redactValue(change.To)}
+		}
+	}
+
+	return changes, nil
+}
+
+// toFields decodes the JSON encoding of v into a map of its fields.
+func toFields(v any) (map[string]any, error) {
+	fields := map[string]any{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func redactValue(v any) any {
+	if v == nil {
+		return nil
+	}
+
+	return redacted
+}
@@ -4,11 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"strings"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
 )
 
 var ErrEventNotFound = errors.New("event not found")
 
+// Ways of attending an event.
+const (
+	AttendanceInPerson = "in_person"
+	AttendanceOnline   = "online"
+	AttendanceHybrid   = "hybrid"
+)
+
+// Platforms online events can be hosted on.
+var OnlinePlatforms = []string{"zoom", "google_meet", "microsoft_teams", "youtube", "other"}
+
 type Event struct {
 	Id              int     `json:"id"`
 	Title           string  `json:"title"`
@@ -27,57 +40,119 @@ type Event struct {
 	UpdatedAt       string  `json:"updated_at"`
 	IsVisible       bool    `json:"is_visible"`
 	ContactInfo     string  `json:"contact_info"`
+	DeletedAt       *string `json:"deleted_at,omitempty"`
+	// Version is incremented on every change and used to detect concurrent
+	// updates.
+	Version int `json:"version"`
+	// AttendanceMode is one of AttendanceInPerson, AttendanceOnline or
+	// AttendanceHybrid. Online and hybrid events are joined through
+	// OnlineUrl, which along with OnlineAccessInstructions is only shown to
+	// registered attendees.
+	AttendanceMode           string  `json:"attendance_mode"`
+	OnlineUrl                *string `json:"online_url"`
+	OnlinePlatform           *string `json:"online_platform"`
+	OnlineAccessInstructions *string `json:"online_access_instructions"`
+	// DistanceKm is the distance to the event's location when searching for
+	// events near a point.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	// Location is the venue of the event, filled in by AttachLocations.
+	Location *Location `json:"location,omitempty"`
+	// OrganizationIds are the ids of all organizations hosting the event,
+	// including the primary host in OrganizationId.
+	OrganizationIds []int `json:"organization_ids"`
+	// Hosts are the organizations hosting the event, filled in by
+	// AttachHosts.
+	Hosts []EventHost `json:"hosts"`
+	// Image holds the files of the event's image, filled in by AttachImages.
+	Image *ImageSources `json:"image,omitempty"`
 }
 
-// FindNRecentEvents finds the n most recent events in db and orders them from
-// most recent to least recent.
-func FindNRecentEvents(ctx context.Context, db *sql.DB, n int) ([]Event, error) {
-	query := `SELECT * FROM events ORDER BY date DESC LIMIT ?`
-	rows, err := db.QueryContext(ctx, query, n)
-	if err != nil {
-		return nil, err
-	}
+// IsOnline reports whether the event can be attended online.
+func (e *Event) IsOnline() bool {
+	return e.AttendanceMode == AttendanceOnline || e.AttendanceMode == AttendanceHybrid
+}
 
-	events := []Event{}
-	for rows.Next() {
-		var event Event
-		err := rows.Scan(
-			&event.Id,
-			&event.Title,
-			&event.Description,
-			&event.StartDate,
-			&event.EndDate,
-			&event.OrganizationId,
-			&event.ImageId,
-			&event.LocationId,
-			&event.LocationDetails,
-			&event.Price,
-			&event.CategoryId,
-			&event.AdditionalInfo,
-			&event.AdditionalUrl,
-			&event.CreatedAt,
-			&event.UpdatedAt,
-			&event.IsVisible,
-			&event.ContactInfo,
-		)
+// HideOnlineAccess removes the details needed to join the event online, for
+// users who aren't registered to attend it.
+func (e *Event) HideOnlineAccess() {
+	e.OnlineUrl = nil
+	e.OnlineAccessInstructions = nil
+}
 
-		if err != nil {
-			return nil, err
-		}
+// EventFilter narrows down the events returned by FindEvents.
+type EventFilter struct {
+	Limit int
+	// IncludeDeleted also returns soft-deleted events.
+	IncludeDeleted bool
+	// Near only returns events whose location is within RadiusKm of this
+	// point, nearest first.
+	Near     *GeoPoint
+	RadiusKm float64
+	// Venue only returns events at a location with every accessibility
+	// feature set to true in it.
+	Venue Accessibility
+	// MinCapacity only returns events at a location holding at least this
+	// many people.
+	MinCapacity int
+	// OrganizationId only returns events hosted or co-hosted by this
+	// organization.
+	OrganizationId *int
+	// Upcoming only returns events that haven't ended yet, soonest first.
+	Upcoming bool
+}
 
-		events = append(events, event)
-	}
+// needsLocation reports whether the filter applies to the events' location.
+func (f EventFilter) needsLocation() bool {
+	return f.Near != nil ||
+		f.MinCapacity > 0 ||
+		isTrue(f.Venue.StepFreeAccess) ||
+		isTrue(f.Venue.Elevator) ||
+		isTrue(f.Venue.AccessibleRestroom) ||
+		isTrue(f.Venue.AslAvailable)
+}
 
-	return events, nil
+func isTrue(b *bool) bool {
+	return b != nil && *b
 }
 
-// FindEventById finds an event in db by its id eventId.
-func FindEventById(ctx context.Context, db *sql.DB, eventId int) (*Event, error) {
-	query := `SELECT * FROM events WHERE id = ?`
-	row := db.QueryRowContext(ctx, query, eventId)
+// eventColumns lists the events columns in the order scanEvent expects them.
+// They are qualified so that they can be selected alongside joined tables.
+const eventColumns = `
+	events.id,
+	events.title,
+	events.description,
+	events.start_date,
+	events.end_date,
+	events.organization_id,
+	events.image_id,
+	events.location_id,
+	events.location_details,
+	events.price,
+	events.category_id,
+	events.additional_info,
+	events.additional_url,
+	events.created_at,
+	events.updated_at,
+	events.is_visible,
+	events.contact_info,
+	events.deleted_at,
+	events.version,
+	events.attendance_mode,
+	events.online_url,
+	events.online_platform,
+	events.online_access_instructions
+`
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanEvent scans a row selected with eventColumns into an Event. Columns
+// selected after eventColumns are scanned into extra.
+func scanEvent(row rowScanner, extra ...any) (Event, error) {
 	var event Event
-	err := row.Scan(
+	dest := []any{
 		&event.Id,
 		&event.Title,
 		&event.Description,
@@ -95,22 +170,172 @@ func FindEventById(ctx context.Context, db *sql.DB, eventId int) (*Event, error)
 		&event.UpdatedAt,
 		&event.IsVisible,
 		&event.ContactInfo,
-	)
+		&event.DeletedAt,
+		&event.Version,
+		&event.AttendanceMode,
+		&event.OnlineUrl,
+		&event.OnlinePlatform,
+		&event.OnlineAccessInstructions,
+	}
+	err := row.Scan(append(dest, extra...)...)
+
+	return event, err
+}
+
+// FindEvents finds the events matching filter. Events are ordered from most
+// recent to least recent, from nearest to farthest when filter.Near is set, or
+// from soonest to latest when filter.Upcoming is set.
+func FindEvents(ctx context.Context, db *sql.DB, filter EventFilter) ([]Event, error) {
+	conditions := []string{}
+	args := []any{}
+
+	query := `SELECT ` + eventColumns
+	if filter.Near != nil {
+		// ST_Distance_Sphere returns meters.
+		query += `,
+			ST_Distance_Sphere(
+				locations.coordinates,
+				ST_PointFromText(?, 4326, 'axis-order=long-lat')
+			) / 1000 AS distance_km
+		`
+		args = append(args, pointWKT(&filter.Near.Latitude, &filter.Near.Longitude))
+
+		// The bounding boxes let the spatial index discard far away locations
+		// before distances are computed.
+		within, withinArgs := withinBoundingBoxes("locations.coordinates", *filter.Near, filter.RadiusKm)
+		conditions = append(conditions, "locations.latitude IS NOT NULL", within)
+		args = append(args, withinArgs...)
+	}
+
+	query += ` FROM events`
+	if filter.needsLocation() {
+		query += ` JOIN locations ON locations.id = events.location_id`
+	}
+
+	venueFeatures := []struct {
+		column   string
+		required *bool
+	}{
+		{"step_free_access", filter.Venue.StepFreeAccess},
+		{"elevator", filter.Venue.Elevator},
+		{"accessible_restroom", filter.Venue.AccessibleRestroom},
+		{"asl_available", filter.Venue.AslAvailable},
+	}
+	for _, feature := range venueFeatures {
+		if isTrue(feature.required) {
+			conditions = append(conditions, "locations."+feature.column+" = 1")
+		}
+	}
+
+	if filter.MinCapacity > 0 {
+		conditions = append(conditions, "locations.capacity >= ?")
+		args = append(args, filter.MinCapacity)
+	}
+
+	if filter.OrganizationId != nil {
+		conditions = append(conditions,
+			"events.id IN (SELECT event_id FROM event_organizations WHERE organization_id = ?)")
+		args = append(args, *filter.OrganizationId)
+	}
+
+	if filter.Upcoming {
+		conditions = append(conditions, "events.end_date >= CURRENT_TIMESTAMP")
+	}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "events.deleted_at IS NULL")
+	}
+
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	if filter.Near != nil {
+		query += ` HAVING distance_km <= ? ORDER BY distance_km`
+		args = append(args, filter.RadiusKm)
+	} else if filter.Upcoming {
+		query += ` ORDER BY events.start_date`
+	} else {
+		query += ` ORDER BY events.start_date DESC`
+	}
+
+	query += ` LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find events", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var extra []any
+		var distance float64
+		if filter.Near != nil {
+			extra = append(extra, &distance)
+		}
+
+		event, err := scanEvent(rows, extra...)
+		if err != nil {
+			return nil, err
+		}
+
+		if filter.Near != nil {
+			event.DistanceKm = &distance
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over event rows", "error", err)
+		return nil, err
+	}
+
+	eventPtrs := make([]*Event, len(events))
+	for i := range events {
+		eventPtrs[i] = &events[i]
+	}
+
+	if err := AttachHosts(ctx, db, eventPtrs...); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// FindEventById finds an event in db by its id eventId. A soft-deleted event
+// is only found when includeDeleted is true.
+func FindEventById(ctx context.Context, db DBTX, eventId int, includeDeleted bool) (*Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events WHERE events.id = ?`
+	if !includeDeleted {
+		query += ` AND events.deleted_at IS NULL`
+	}
+	row := db.QueryRowContext(ctx, query, eventId)
 
+	event, err := scanEvent(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrEventNotFound
 		}
-		log.Printf("failed to find event by id: %s\nid: %d\n", err, eventId)
+		logging.FromContext(ctx).Error("failed to find event by id", "error", err, "id", eventId)
 
 		return nil, err
 	}
 
+	if err := AttachHosts(ctx, db, &event); err != nil {
+		return nil, err
+	}
+
 	return &event, nil
 }
 
-// InsertEvent inserts event into db. The id of the event inserted is returned.
-func InsertEvent(ctx context.Context, db *sql.DB, event Event) (int, error) {
+// InsertEvent inserts event into db along with its hosts. The id of the event
+// inserted is returned. Use a transaction as db so that the event isn't left
+// without hosts if inserting them fails.
+func InsertEvent(ctx context.Context, db DBTX, event Event) (int, error) {
 	query := `
 		INSERT INTO events (
 			title,
@@ -125,8 +350,12 @@ func InsertEvent(ctx context.Context, db *sql.DB, event Event) (int, error) {
 			category_id,
 			additional_info,
 			additional_url,
-			contact_info
-		) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )
+			contact_info,
+			attendance_mode,
+			online_url,
+			online_platform,
+			online_access_instructions
+		) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )
 	`
 	result, err := db.ExecContext(ctx, query,
 		event.Title,
@@ -142,28 +371,32 @@ func InsertEvent(ctx context.Context, db *sql.DB, event Event) (int, error) {
 		event.AdditionalInfo,
 		event.AdditionalUrl,
 		event.ContactInfo,
+		event.AttendanceMode,
+		event.OnlineUrl,
+		event.OnlinePlatform,
+		event.OnlineAccessInstructions,
 	)
 
 	if err != nil {
-		log.Printf("failed to insert event: %s\n", err)
+		logging.FromContext(ctx).Error("failed to insert event", "error", err)
 		return 0, err
 	}
 
 	eventId, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("failed to retreive event id: %s\n", err)
+		logging.FromContext(ctx).Error("failed to retreive event id", "error", err)
 		return 0, err
 	}
 
+	err = setEventHosts(ctx, db, int(eventId), event.OrganizationId, event.OrganizationIds)
+
 	return int(eventId), err
 }
 
-// UpdateEvent updates an event in db.
-func UpdateEvent(ctx context.Context, db *sql.DB, event *Event) error {
-	if _, err := FindEventById(ctx, db, event.Id); err != nil {
-		return err
-	}
-
+// UpdateEvent updates an event in db and replaces its hosts. The update only
+// happens if the event is still at event.Version, ErrVersionMismatch is
+// returned otherwise.
+func UpdateEvent(ctx context.Context, db DBTX, event *Event) error {
 	query := `
 		UPDATE events SET
 			title = ?,
@@ -179,10 +412,15 @@ func UpdateEvent(ctx context.Context, db *sql.DB, event *Event) error {
 			additional_info = ?,
 			additional_url = ?,
 			contact_info = ?,
-			updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
+			attendance_mode = ?,
+			online_url = ?,
+			online_platform = ?,
+			online_access_instructions = ?,
+			updated_at = CURRENT_TIMESTAMP,
+			version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL
 	`
-	_, err := db.ExecContext(ctx, query,
+	result, err := db.ExecContext(ctx, query,
 		event.Title,
 		event.Description,
 		event.StartDate,
@@ -196,29 +434,133 @@ func UpdateEvent(ctx context.Context, db *sql.DB, event *Event) error {
 		event.AdditionalInfo,
 		event.AdditionalUrl,
 		event.ContactInfo,
+		event.AttendanceMode,
+		event.OnlineUrl,
+		event.OnlinePlatform,
+		event.OnlineAccessInstructions,
 		event.Id,
+		event.Version,
 	)
 
 	if err != nil {
-		log.Printf("failed to update event: %s\n", err)
+		logging.FromContext(ctx).Error("failed to update event", "error", err)
 		return err
 	}
 
-	return nil
+	if err := eventVersionMatched(ctx, db, result, event.Id); err != nil {
+		return err
+	}
+
+	return setEventHosts(ctx, db, event.Id, event.OrganizationId, event.OrganizationIds)
+}
+
+// DeleteEvent soft deletes an event using eventId. The event is kept in db
+// until it is purged and can be brought back with RestoreEvent. The event is
+// only deleted if it is still at version, ErrVersionMismatch is returned
+// otherwise.
+func DeleteEvent(ctx context.Context, db *sql.DB, eventId, version int) error {
+	query := `
+		UPDATE events SET
+			deleted_at = CURRENT_TIMESTAMP,
+			version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL
+	`
+	result, err := db.ExecContext(ctx, query, eventId, version)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete event", "error", err, "id", eventId)
+		return err
+	}
+
+	return eventVersionMatched(ctx, db, result, eventId)
+}
+
+// eventVersionMatched tells apart the reasons why a versioned statement on
+// the event eventId didn't affect any rows.
+func eventVersionMatched(ctx context.Context, db DBTX, result sql.Result, eventId int) error {
+	err := requireAffected(ctx, result, ErrVersionMismatch)
+	if !errors.Is(err, ErrVersionMismatch) {
+		return err
+	}
+
+	if _, err := FindEventById(ctx, db, eventId, false); err != nil {
+		return err
+	}
+
+	return ErrVersionMismatch
 }
 
-// DeleteEvent deletes an event using eventId.
-func DeleteEvent(ctx context.Context, db *sql.DB, eventId int) error {
-	if _, err := FindEventById(ctx, db, eventId); err != nil {
+// RestoreEvent undoes the soft deletion of an event using eventId.
+func RestoreEvent(ctx context.Context, db *sql.DB, eventId int) error {
+	query := `
+		UPDATE events SET
+			deleted_at = NULL,
+			version = version + 1
+		WHERE id = ? AND deleted_at IS NOT NULL
+	`
+	result, err := db.ExecContext(ctx, query, eventId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to restore event", "error", err, "id", eventId)
 		return err
 	}
 
-	query := `DELETE FROM events WHERE id = ?`
-	_, err := db.ExecContext(ctx, query, eventId)
+	return requireAffected(ctx, result, ErrEventNotFound)
+}
+
+// PurgeDeletedEvents permanently removes events that were soft deleted before
+// cutoff. The number of events removed is returned.
+func PurgeDeletedEvents(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	query := `DELETE FROM events WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	result, err := db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to purge deleted events", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// AttachLocations fills in the Location of events that have one.
+func AttachLocations(ctx context.Context, db *sql.DB, events ...*Event) error {
+	locationIds := []int{}
+	for _, event := range events {
+		if event.LocationId != nil {
+			locationIds = append(locationIds, *event.LocationId)
+		}
+	}
+
+	locations, err := FindLocationsByIds(ctx, db, locationIds)
 	if err != nil {
-		log.Printf("failed to delete event: %s\nid: %d\n", err, eventId)
 		return err
 	}
 
+	for _, event := range events {
+		if event.LocationId != nil {
+			event.Location = locations[*event.LocationId]
+		}
+	}
+
+	return nil
+}
+
+// AttachImages fills in the Image of events that have one.
+func AttachImages(ctx context.Context, db *sql.DB, events ...*Event) error {
+	imageIds := []int{}
+	for _, event := range events {
+		if event.ImageId != nil {
+			imageIds = append(imageIds, *event.ImageId)
+		}
+	}
+
+	sources, err := FindImageSources(ctx, db, imageIds)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if event.ImageId != nil {
+			event.Image = sources[*event.ImageId]
+		}
+	}
+
 	return nil
 }
@@ -4,12 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"net/url"
+
+	"github.com/somos831/somos-backend/logging"
 )
 
 var ErrEventCategoryNotFound = errors.New("event category not found")
 
+// CategoryVirtual is the id of the seeded "virtual" event category.
+const CategoryVirtual = 7
+
 type EventCategory struct {
 	Id   int    `json:"id"`
 	Name string `json:"name"`
@@ -19,7 +23,7 @@ func GetAllCategories(ctx context.Context, db *sql.DB) ([]EventCategory, error)
 	query := `SELECT * FROM event_categories`
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		log.Printf("failed to get event_categories: %s\n", err)
+		logging.FromContext(ctx).Error("failed to get event_categories", "error", err)
 		return []EventCategory{}, err
 	}
 	defer rows.Close()
@@ -30,13 +34,13 @@ func GetAllCategories(ctx context.Context, db *sql.DB) ([]EventCategory, error)
 
 		err := rows.Scan(&eCategory.Id, &eCategory.Name)
 		if err != nil {
-			log.Printf("failed to get event_categories: %s\n", err)
+			logging.FromContext(ctx).Error("failed to get event_categories", "error", err)
 		}
 		eventCategories = append(eventCategories, eCategory)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("error encountered while iterating over event category rows: %s", err)
+		logging.FromContext(ctx).Error("error encountered while iterating over event category rows", "error", err)
 		return []EventCategory{}, err
 	}
 
@@ -58,7 +62,7 @@ func FindEventCategoryById(ctx context.Context, db *sql.DB, categoryId int) (*Ev
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrEventCategoryNotFound
 		}
-		log.Printf("failed to find event category by id:%s\nid: %d\n", err, categoryId)
+		logging.FromContext(ctx).Error("failed to find event category by id", "error", err, "id", categoryId)
 
 		return nil, err
 	}
@@ -81,7 +85,7 @@ func FindEventCategoryByName(ctx context.Context, db *sql.DB, name string) (*Eve
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrEventCategoryNotFound
 		}
-		log.Printf("failed to find event category by name:%s\nname: %s\n", err, name)
+		logging.FromContext(ctx).Error("failed to find event category by name", "error", err, "name", name)
 
 		return nil, err
 	}
@@ -94,13 +98,13 @@ func InsertEventCategory(ctx context.Context, db *sql.DB, category EventCategory
 	query := `INSERT INTO event_categories (name) VALUES (?)`
 	result, err := db.ExecContext(ctx, query, category.Name)
 	if err != nil {
-		log.Printf("failed to insert event category: %s\ncategory: %#v\n", err, category)
+		logging.FromContext(ctx).Error("failed to insert event category", "error", err, "category", category)
 		return 0, err
 	}
 
 	categoryId, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("failed to retreive event category id: %s\n", err)
+		logging.FromContext(ctx).Error("failed to retreive event category id", "error", err)
 		return 0, err
 	}
 
@@ -116,7 +120,7 @@ func UpdateEventCategory(ctx context.Context, db *sql.DB, category EventCategory
 	query := `UPDATE event_categories SET name = ? WHERE id = ?`
 	_, err := db.ExecContext(ctx, query, category.Name, category.Id)
 	if err != nil {
-		log.Printf("failed to update event category: %s\ncategory: %#v\n", err, category)
+		logging.FromContext(ctx).Error("failed to update event category", "error", err, "category", category)
 		return err
 	}
 
@@ -132,7 +136,7 @@ func DeleteEventCategory(ctx context.Context, db *sql.DB, categoryId int) error
 	query := `DELETE FROM event_categories WHERE id = ?`
 	_, err := db.ExecContext(ctx, query, categoryId)
 	if err != nil {
-		log.Printf("failed to delete event category: %s\nid: %d\n", err, categoryId)
+		logging.FromContext(ctx).Error("failed to delete event category", "error", err, "id", categoryId)
 		return err
 	}
 
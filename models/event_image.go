@@ -0,0 +1,341 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// Statuses of gallery photos. Pending photos are only shown to editors and
+// the event's managers until an editor approves them.
+const (
+	EventImagePending  = "pending"
+	EventImageApproved = "approved"
+)
+
+// MaxEventImages is how many photos an event's gallery can hold, pending ones
+// included.
+const MaxEventImages = 200
+
+var (
+	ErrEventImageNotFound = errors.New("image not found in the event's gallery")
+	ErrEventImageExists   = errors.New("image is already in the event's gallery")
+	ErrEventGalleryFull   = errors.New("event gallery is full")
+	ErrEventImageOrder    = errors.New("image_ids must list every image in the event's gallery exactly once")
+)
+
+// EventImage is a photo in the gallery of an event.
+type EventImage struct {
+	EventId int `json:"event_id"`
+	ImageId int `json:"image_id"`
+	// Position orders the gallery, starting at 1.
+	Position     int     `json:"position"`
+	Caption      *string `json:"caption"`
+	Photographer *string `json:"photographer"`
+	// Alt describes the photo in the gallery. It defaults to the image's alt
+	// text.
+	Alt         string        `json:"alt"`
+	Status      string        `json:"status"`
+	SubmittedBy *int          `json:"submitted_by"`
+	CreatedAt   string        `json:"created_at"`
+	UpdatedAt   string        `json:"updated_at"`
+	Image       *ImageSources `json:"image"`
+}
+
+// eventImageColumns lists the event_images columns in the order
+// scanEventImage expects them.
+const eventImageColumns = `
+	event_id,
+	image_id,
+	position,
+	caption,
+	photographer,
+	alt,
+	status,
+	submitted_by,
+	created_at,
+	updated_at
+`
+
+// scanEventImage scans a row selected with eventImageColumns into an
+// EventImage.
+func scanEventImage(row rowScanner) (EventImage, error) {
+	var img EventImage
+	err := row.Scan(
+		&img.EventId,
+		&img.ImageId,
+		&img.Position,
+		&img.Caption,
+		&img.Photographer,
+		&img.Alt,
+		&img.Status,
+		&img.SubmittedBy,
+		&img.CreatedAt,
+		&img.UpdatedAt,
+	)
+
+	return img, err
+}
+
+// FindEventImages finds the gallery of the event eventId in order, with the
+// sources of each photo. Pending photos are left out unless includePending
+// is set.
+func FindEventImages(ctx context.Context, db *sql.DB, eventId int, includePending bool) ([]EventImage, error) {
+	query := `SELECT ` + eventImageColumns + ` FROM event_images WHERE event_id = ?`
+	args := []any{eventId}
+	if !includePending {
+		query += ` AND status = ?`
+		args = append(args, EventImageApproved)
+	}
+	query += ` ORDER BY position, image_id`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find event images", "error", err, "event_id", eventId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []EventImage{}
+	imageIds := []int{}
+	for rows.Next() {
+		img, err := scanEventImage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, img)
+		imageIds = append(imageIds, img.ImageId)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over event image rows", "error", err)
+		return nil, err
+	}
+
+	sources, err := FindImageSources(ctx, db, imageIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range images {
+		images[i].Image = sources[images[i].ImageId]
+		if images[i].Image != nil {
+			images[i].Image.Alt = images[i].Alt
+		}
+	}
+
+	return images, nil
+}
+
+// FindEventImage finds the image imageId in the gallery of the event eventId,
+// with its sources.
+func FindEventImage(ctx context.Context, db *sql.DB, eventId, imageId int) (*EventImage, error) {
+	query := `SELECT ` + eventImageColumns + ` FROM event_images WHERE event_id = ? AND image_id = ?`
+	img, err := scanEventImage(db.QueryRowContext(ctx, query, eventId, imageId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEventImageNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find event image", "error", err, "event_id", eventId, "image_id", imageId)
+		return nil, err
+	}
+
+	sources, err := FindImageSources(ctx, db, []int{imageId})
+	if err != nil {
+		return nil, err
+	}
+
+	img.Image = sources[imageId]
+	if img.Image != nil {
+		img.Image.Alt = img.Alt
+	}
+
+	return &img, nil
+}
+
+// InsertEventImage adds img to the end of its event's gallery.
+func InsertEventImage(ctx context.Context, db *sql.DB, img EventImage) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		// Locking the gallery keeps concurrent additions from sharing a
+		// position.
+		rows, err := tx.QueryContext(ctx,
+			`SELECT image_id, position FROM event_images WHERE event_id = ? FOR UPDATE`, img.EventId)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to lock event images", "error", err, "event_id", img.EventId)
+			return err
+		}
+		defer rows.Close()
+
+		count, last := 0, 0
+		for rows.Next() {
+			var imageId, position int
+			if err := rows.Scan(&imageId, &position); err != nil {
+				return err
+			}
+
+			if imageId == img.ImageId {
+				return ErrEventImageExists
+			}
+
+			count++
+			last = max(last, position)
+		}
+
+		if err := rows.Err(); err != nil {
+			logging.FromContext(ctx).Error("error encountered while iterating over event image rows", "error", err)
+			return err
+		}
+		rows.Close()
+
+		if count >= MaxEventImages {
+			return ErrEventGalleryFull
+		}
+
+		query := `
+			INSERT INTO event_images (
+				event_id,
+				image_id,
+				position,
+				caption,
+				photographer,
+				alt,
+				status,
+				submitted_by
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, query,
+			img.EventId,
+			img.ImageId,
+			last+1,
+			img.Caption,
+			img.Photographer,
+			img.Alt,
+			img.Status,
+			img.SubmittedBy,
+		)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to insert event image", "error", err, "event_id", img.EventId, "image_id", img.ImageId)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// UpdateEventImage updates the caption, photographer and alt text of a photo
+// in an event's gallery.
+func UpdateEventImage(ctx context.Context, db *sql.DB, img EventImage) error {
+	query := `
+		UPDATE event_images
+		SET caption = ?, photographer = ?, alt = ?
+		WHERE event_id = ? AND image_id = ?
+	`
+	result, err := db.ExecContext(ctx, query, img.Caption, img.Photographer, img.Alt, img.EventId, img.ImageId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update event image", "error", err, "event_id", img.EventId, "image_id", img.ImageId)
+		return err
+	}
+
+	// Unchanged rows affect no rows either, so only a missing photo is an
+	// error.
+	n, err := result.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	_, err = FindEventImage(ctx, db, img.EventId, img.ImageId)
+	return err
+}
+
+// ApproveEventImage makes a pending photo in the gallery of the event eventId
+// public.
+func ApproveEventImage(ctx context.Context, db *sql.DB, eventId, imageId int) error {
+	query := `UPDATE event_images SET status = ? WHERE event_id = ? AND image_id = ?`
+	result, err := db.ExecContext(ctx, query, EventImageApproved, eventId, imageId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to approve event image", "error", err, "event_id", eventId, "image_id", imageId)
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	_, err = FindEventImage(ctx, db, eventId, imageId)
+	return err
+}
+
+// ReorderEventImages orders the gallery of the event eventId as imageIds,
+// which must list every photo in the gallery, pending ones included.
+func ReorderEventImages(ctx context.Context, db *sql.DB, eventId int, imageIds []int) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT image_id FROM event_images WHERE event_id = ? FOR UPDATE`, eventId)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to lock event images", "error", err, "event_id", eventId)
+			return err
+		}
+		defer rows.Close()
+
+		current := []int{}
+		for rows.Next() {
+			var imageId int
+			if err := rows.Scan(&imageId); err != nil {
+				return err
+			}
+			current = append(current, imageId)
+		}
+
+		if err := rows.Err(); err != nil {
+			logging.FromContext(ctx).Error("error encountered while iterating over event image rows", "error", err)
+			return err
+		}
+		rows.Close()
+
+		sorted := slices.Clone(imageIds)
+		slices.Sort(sorted)
+		slices.Sort(current)
+		if !slices.Equal(sorted, current) {
+			return ErrEventImageOrder
+		}
+
+		if len(imageIds) == 0 {
+			return nil
+		}
+
+		query := `UPDATE event_images SET position = CASE image_id`
+		args := []any{}
+		for i, imageId := range imageIds {
+			query += ` WHEN ? THEN ?`
+			args = append(args, imageId, i+1)
+		}
+		query += ` END WHERE event_id = ?`
+		args = append(args, eventId)
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to reorder event images", "error", err, "event_id", eventId)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// DeleteEventImage removes the image imageId from the gallery of the event
+// eventId. The image itself is left for the garbage collector.
+func DeleteEventImage(ctx context.Context, db *sql.DB, eventId, imageId int) error {
+	query := `DELETE FROM event_images WHERE event_id = ? AND image_id = ?`
+	result, err := db.ExecContext(ctx, query, eventId, imageId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete event image", "error", err, "event_id", eventId, "image_id", imageId)
+		return err
+	}
+
+	return requireAffected(ctx, result, ErrEventImageNotFound)
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"slices"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// EventHost is an organization hosting an event.
+type EventHost struct {
+	OrganizationId int    `json:"organization_id"`
+	Name           string `json:"name"`
+	LogoImageId    *int   `json:"logo_image_id"`
+	// IsPrimary is set for the organization in the event's OrganizationId.
+	IsPrimary bool `json:"is_primary"`
+}
+
+// NormalizeHosts makes OrganizationId and OrganizationIds agree. Without
+// OrganizationIds, the primary host is the only host. Without OrganizationId,
+// the first of OrganizationIds is the primary host. Repeated ids are dropped.
+func (e *Event) NormalizeHosts() {
+	ids := []int{}
+	for _, id := range e.OrganizationIds {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 && e.OrganizationId != nil {
+		ids = append(ids, *e.OrganizationId)
+	}
+
+	if e.OrganizationId == nil && len(ids) > 0 {
+		primary := ids[0]
+		e.OrganizationId = &primary
+	}
+
+	e.OrganizationIds = ids
+}
+
+// setEventHosts replaces the organizations hosting the event eventId with
+// orgIds, primary being the primary host.
+func setEventHosts(ctx context.Context, db DBTX, eventId int, primary *int, orgIds []int) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM event_organizations WHERE event_id = ?`, eventId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to remove event hosts", "error", err, "event_id", eventId)
+		return err
+	}
+
+	if len(orgIds) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO event_organizations (event_id, organization_id, is_primary) VALUES `
+	args := []any{}
+	for i, orgId := range orgIds {
+		if i > 0 {
+			query += `, `
+		}
+		query += `(?, ?, ?)`
+		args = append(args, eventId, orgId, primary != nil && *primary == orgId)
+	}
+
+	_, err = db.ExecContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert event hosts", "error", err, "event_id", eventId)
+		return err
+	}
+
+	return nil
+}
+
+// AttachHosts fills in the OrganizationIds and Hosts of events, primary host
+// first.
+func AttachHosts(ctx context.Context, db DBTX, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	args := []any{}
+	for _, event := range events {
+		args = append(args, event.Id)
+	}
+
+	query := `
+		SELECT
+			event_organizations.event_id,
+			organizations.id,
+			organizations.name,
+			organizations.logo_image_id,
+			event_organizations.is_primary
+		FROM event_organizations
+		JOIN organizations ON organizations.id = event_organizations.organization_id
+		WHERE event_organizations.event_id IN (` + placeholders(len(events)) + `)
+		ORDER BY event_organizations.is_primary DESC, organizations.name
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find event hosts", "error", err)
+		return err
+	}
+	defer rows.Close()
+
+	hosts := map[int][]EventHost{}
+	for rows.Next() {
+		var eventId int
+		var host EventHost
+		err := rows.Scan(&eventId, &host.OrganizationId, &host.Name, &host.LogoImageId, &host.IsPrimary)
+		if err != nil {
+			return err
+		}
+
+		hosts[eventId] = append(hosts[eventId], host)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over event host rows", "error", err)
+		return err
+	}
+
+	for _, event := range events {
+		event.Hosts = hosts[event.Id]
+		if event.Hosts == nil {
+			event.Hosts = []EventHost{}
+		}
+
+		event.OrganizationIds = []int{}
+		for _, host := range event.Hosts {
+			event.OrganizationIds = append(event.OrganizationIds, host.OrganizationId)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+var ErrEventRevisionNotFound = errors.New("event revision not found")
+
+// EventRevision is a snapshot of an event taken every time it is created,
+// updated or rolled back.
+type EventRevision struct {
+	EventId  int    `json:"event_id"`
+	Revision int    `json:"revision"`
+	Snapshot *Event `json:"snapshot,omitempty"`
+	// CreatedBy is the id of the user who made the change, if known.
+	CreatedBy *int `json:"created_by"`
+	// RolledBackFrom is the revision this revision restored, if any.
+	RolledBackFrom *int   `json:"rolled_back_from"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// InsertEventWithRevision inserts event into db and records it as the event's
+// first revision. The id of the event inserted is returned.
+func InsertEventWithRevision(ctx context.Context, db *sql.DB, event Event, userId *int) (int, error) {
+	var eventId int
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		var err error
+		eventId, err = InsertEvent(ctx, tx, event)
+		if err != nil {
+			return err
+		}
+
+		_, err = recordEventRevision(ctx, tx, eventId, userId, nil)
+
+		return err
+	})
+
+	return eventId, err
+}
+
+// UpdateEventWithRevision updates event in db and records the result as a new
+// revision. The updated event is returned.
+func UpdateEventWithRevision(ctx context.Context, db *sql.DB, event *Event, userId *int) (*Event, error) {
+	return updateEventWithRevision(ctx, db, event, userId, nil)
+}
+
+// RollbackEvent restores the event eventId to the state it was in at revision,
+// provided the event is still at version. The rollback is recorded as a new
+// revision and the restored event is returned. Revisions don't keep their
+// image from being garbage collected, the event is restored without an image
+// if it is gone.
+func RollbackEvent(ctx context.Context, db *sql.DB, eventId, revision, version int, userId *int) (*Event, error) {
+	rev, err := FindEventRevision(ctx, db, eventId, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	event := *rev.Snapshot
+	event.Id = eventId
+	event.Version = version
+
+	return updateEventWithRevision(ctx, db, &event, userId, &revision)
+}
+
+func updateEventWithRevision(ctx context.Context, db *sql.DB, event *Event, userId *int, rolledBackFrom *int) (*Event, error) {
+	var updated *Event
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		if err := recordInitialEventRevision(ctx, tx, event.Id); err != nil {
+			return err
+		}
+
+		if rolledBackFrom != nil && event.ImageId != nil {
+			exists, err := lockImage(ctx, tx, *event.ImageId)
+			if err != nil {
+				return err
+			}
+
+			if !exists {
+				event.ImageId = nil
+			}
+		}
+
+		if err := UpdateEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = recordEventRevision(ctx, tx, event.Id, userId, rolledBackFrom)
+
+		return err
+	})
+
+	return updated, err
+}
+
+// recordInitialEventRevision records the current state of the event eventId
+// as its first revision if it has none, before it is changed. Events created
+// before revisions were tracked then have a state to be rolled back to.
+func recordInitialEventRevision(ctx context.Context, tx *sql.Tx, eventId int) error {
+	latest, err := latestEventRevision(ctx, tx, eventId)
+	if err != nil {
+		return err
+	}
+
+	if latest == 0 {
+		_, err = recordEventRevision(ctx, tx, eventId, nil, nil)
+	}
+
+	return err
+}
+
+// recordEventRevision snapshots the current state of the event eventId as its
+// next revision. The snapshot is returned.
+func recordEventRevision(ctx context.Context, tx *sql.Tx, eventId int, userId *int, rolledBackFrom *int) (*Event, error) {
+	event, err := FindEventById(ctx, tx, eventId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := latestEventRevision(ctx, tx, eventId)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO event_revisions (
+			event_id,
+			revision,
+			snapshot,
+			created_by,
+			rolled_back_from
+		) VALUES ( ?, ?, ?, ?, ? )
+	`
+	_, err = tx.ExecContext(ctx, query, eventId, latest+1, snapshot, userId, rolledBackFrom)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert event revision", "error", err, "event_id", eventId)
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// lockImage reports whether the image imageId exists, keeping it from being
+// garbage collected until tx ends if it does.
+func lockImage(ctx context.Context, tx *sql.Tx, imageId int) (bool, error) {
+	var exists int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM images WHERE id = ? FOR SHARE`, imageId).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to lock image", "error", err, "id", imageId)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// latestEventRevision returns the latest revision number of the event
+// eventId, or 0 if it has none. The event's revisions are locked until tx
+// ends so that concurrent updates can't record the same revision number.
+func latestEventRevision(ctx context.Context, tx *sql.Tx, eventId int) (int, error) {
+	query := `SELECT COALESCE(MAX(revision), 0) FROM event_revisions WHERE event_id = ? FOR UPDATE`
+
+	var latest int
+	if err := tx.QueryRowContext(ctx, query, eventId).Scan(&latest); err != nil {
+		logging.FromContext(ctx).Error("failed to find latest event revision", "error", err, "event_id", eventId)
+		return 0, err
+	}
+
+	return latest, nil
+}
+
+// FindEventRevisions finds all revisions of the event eventId, newest first.
+// Snapshots are left out.
+func FindEventRevisions(ctx context.Context, db *sql.DB, eventId int) ([]EventRevision, error) {
+	query := `
+		SELECT event_id, revision, created_by, rolled_back_from, created_at
+		FROM event_revisions
+		WHERE event_id = ?
+		ORDER BY revision DESC
+	`
+	rows, err := db.QueryContext(ctx, query, eventId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find event revisions", "error", err, "event_id", eventId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []EventRevision{}
+	for rows.Next() {
+		var rev EventRevision
+		err := rows.Scan(&rev.EventId, &rev.Revision, &rev.CreatedBy, &rev.RolledBackFrom, &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over event revision rows", "error", err)
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// FindEventRevision finds a single revision of the event eventId, including
+// its snapshot.
+func FindEventRevision(ctx context.Context, db *sql.DB, eventId, revision int) (*EventRevision, error) {
+	query := `
+		SELECT event_id, revision, snapshot, created_by, rolled_back_from, created_at
+		FROM event_revisions
+		WHERE event_id = ? AND revision = ?
+	`
+	row := db.QueryRowContext(ctx, query, eventId, revision)
+
+	var rev EventRevision
+	var snapshot []byte
+	err := row.Scan(&rev.EventId, &rev.Revision, &snapshot, &rev.CreatedBy, &rev.RolledBackFrom, &rev.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEventRevisionNotFound
+		}
+		logging.FromContext(ctx).Error("failed to find event revision", "error", err, "event_id", eventId, "revision", revision)
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(snapshot, &rev.Snapshot); err != nil {
+		return nil, err
+	}
+
+	// Snapshots taken before online events existed.
+	if rev.Snapshot.AttendanceMode == "" {
+		rev.Snapshot.AttendanceMode = AttendanceInPerson
+	}
+
+	// Snapshots taken before events could have several hosts.
+	rev.Snapshot.NormalizeHosts()
+
+	return &rev, nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// kmPerDegree is the approximate length of a degree of latitude.
+const kmPerDegree = 111.32
+
+// GeoPoint is a position on Earth in degrees.
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// pointWKT returns the well-known text of the point at lat, lon in
+// longitude-latitude axis order. Missing coordinates are stored as POINT(0 0)
+// since spatial columns can't be null.
+func pointWKT(lat, lon *float64) string {
+	if lat == nil || lon == nil {
+		return "POINT(0 0)"
+	}
+
+	return fmt.Sprintf("POINT(%f %f)", *lon, *lat)
+}
+
+// minLongitude is the westernmost longitude MySQL accepts in geographic
+// spatial reference systems, where longitudes are in (-180, 180].
+const minLongitude = -179.999999
+
+// boundingBoxWKTs returns the well-known text of rectangles, in
+// longitude-latitude axis order, that together contain every point within
+// radiusKm of center. They are used to narrow down a distance search with the
+// spatial index. A box crossing the antimeridian is split in two, one on each
+// side of it.
+func boundingBoxWKTs(center GeoPoint, radiusKm float64) []string {
+	// Pad the box since its edges follow geodesics rather than parallels.
+	padded := radiusKm * 1.1
+
+	latDelta := padded / kmPerDegree
+	lonDelta := 180.0
+	if cos := math.Cos(center.Latitude * math.Pi / 180); cos > 0.01 {
+		lonDelta = math.Min(padded/(kmPerDegree*cos), 180)
+	}
+
+	minLat := math.Max(center.Latitude-latDelta, -90)
+	maxLat := math.Min(center.Latitude+latDelta, 90)
+	minLon := center.Longitude - lonDelta
+	maxLon := center.Longitude + lonDelta
+
+	switch {
+	case lonDelta >= 180:
+		return []string{rectangleWKT(minLongitude, minLat, 180, maxLat)}
+	case minLon < -180:
+		return []string{
+			rectangleWKT(minLon+360, minLat, 180, maxLat),
+			rectangleWKT(minLongitude, minLat, maxLon, maxLat),
+		}
+	case maxLon > 180:
+		return []string{
+			rectangleWKT(minLon, minLat, 180, maxLat),
+			rectangleWKT(minLongitude, minLat, maxLon-360, maxLat),
+		}
+	}
+
+	return []string{rectangleWKT(math.Max(minLon, minLongitude), minLat, maxLon, maxLat)}
+}
+
+// withinBoundingBoxes returns a condition, with its arguments, matching the
+// points in column that are in the bounding boxes of the points within
+// radiusKm of center.
+func withinBoundingBoxes(column string, center GeoPoint, radiusKm float64) (string, []any) {
+	conditions := []string{}
+	args := []any{}
+	for _, box := range boundingBoxWKTs(center, radiusKm) {
+		conditions = append(conditions,
+			"MBRContains(ST_PolygonFromText(?, 4326, 'axis-order=long-lat'), "+column+")")
+		args = append(args, box)
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// rectangleWKT returns the well-known text of the rectangle between the given
+// longitudes and latitudes, in longitude-latitude axis order.
+func rectangleWKT(minLon, minLat, maxLon, maxLat float64) string {
+	return fmt.Sprintf("POLYGON((%f %f, %f %f, %f %f, %f %f, %f %f))",
+		minLon, minLat,
+		maxLon, minLat,
+		maxLon, maxLat,
+		minLon, maxLat,
+		minLon, minLat,
+	)
+}
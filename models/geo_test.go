@@ -0,0 +1,55 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBoundingBoxWKTs(t *testing.T) {
+	tests := []struct {
+		name     string
+		center   GeoPoint
+		radiusKm float64
+		want     []string
+	}{
+		{
+			name:     "equator",
+			center:   GeoPoint{Latitude: 0, Longitude: 0},
+			radiusKm: 111.32 / 1.1,
+			want:     []string{"POLYGON((-1.000000 -1.000000, 1.000000 -1.000000, 1.000000 1.000000, -1.000000 1.000000, -1.000000 -1.000000))"},
+		},
+		{
+			name:     "crossing the antimeridian eastwards",
+			center:   GeoPoint{Latitude: 0, Longitude: 179.5},
+			radiusKm: 111.32 / 1.1,
+			want: []string{
+				"POLYGON((178.500000 -1.000000, 180.000000 -1.000000, 180.000000 1.000000, 178.500000 1.000000, 178.500000 -1.000000))",
+				"POLYGON((-179.999999 -1.000000, -179.500000 -1.000000, -179.500000 1.000000, -179.999999 1.000000, -179.999999 -1.000000))",
+			},
+		},
+		{
+			name:     "crossing the antimeridian westwards",
+			center:   GeoPoint{Latitude: 0, Longitude: -179.5},
+			radiusKm: 111.32 / 1.1,
+			want: []string{
+				"POLYGON((179.500000 -1.000000, 180.000000 -1.000000, 180.000000 1.000000, 179.500000 1.000000, 179.500000 -1.000000))",
+				"POLYGON((-179.999999 -1.000000, -178.500000 -1.000000, -178.500000 1.000000, -179.999999 1.000000, -179.999999 -1.000000))",
+			},
+		},
+		{
+			name:     "pole",
+			center:   GeoPoint{Latitude: 90, Longitude: 10},
+			radiusKm: 111.32 / 1.1,
+			want:     []string{"POLYGON((-179.999999 89.000000, 180.000000 89.000000, 180.000000 90.000000, -179.999999 90.000000, -179.999999 89.000000))"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := boundingBoxWKTs(test.center, test.radiusKm)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("boundingBoxWKTs(%v, %v) =\n%q\nwant\n%q", test.center, test.radiusKm, got, test.want)
+			}
+		})
+	}
+}
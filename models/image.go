@@ -0,0 +1,246 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+var ErrImageNotFound = errors.New("image not found")
+
+type Image struct {
+	Id       int    `json:"id"`
+	Filename string `json:"filename"`
+	Url      string `json:"url"`
+	// Alt describes the image for people who can't see it.
+	Alt         string `json:"alt"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int    `json:"size_bytes"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	UploadedBy  *int   `json:"uploaded_by"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	// StorageKey is where the file is kept in storage. Images added before
+	// uploads existed have none.
+	StorageKey *string `json:"-"`
+	// ContentHash is the hex encoded SHA-256 hash of the stored file, used to
+	// find identical uploads.
+	ContentHash *string `json:"-"`
+	// Variants are the resized copies of the image.
+	Variants []ImageVariant `json:"variants"`
+}
+
+// imageColumns lists the images columns in the order scanImage expects them.
+// Images added before uploads existed may be missing any of them.
+const imageColumns = `
+	images.id,
+	COALESCE(images.filename, ''),
+	COALESCE(images.url, ''),
+	COALESCE(images.alt, ''),
+	COALESCE(images.content_type, ''),
+	COALESCE(images.size_bytes, 0),
+	COALESCE(images.width, 0),
+	COALESCE(images.height, 0),
+	images.uploaded_by,
+	images.created_at,
+	images.updated_at,
+	images.storage_key,
+	images.content_hash
+`
+
+// scanImage scans a row selected with imageColumns into an Image.
+func scanImage(row rowScanner) (Image, error) {
+	var img Image
+	err := row.Scan(
+		&img.Id,
+		&img.Filename,
+		&img.Url,
+		&img.Alt,
+		&img.ContentType,
+		&img.SizeBytes,
+		&img.Width,
+		&img.Height,
+		&img.UploadedBy,
+		&img.CreatedAt,
+		&img.UpdatedAt,
+		&img.StorageKey,
+		&img.ContentHash,
+	)
+
+	return img, err
+}
+
+// FindImageById finds an image in db by its id imageId.
+func FindImageById(ctx context.Context, db DBTX, imageId int) (*Image, error) {
+	query := `SELECT ` + imageColumns + ` FROM images WHERE id = ?`
+
+	img, err := scanImage(db.QueryRowContext(ctx, query, imageId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrImageNotFound
+		}
+		logging.FromContext(ctx).Error("failed to find image by id", "error", err, "id", imageId)
+
+		return nil, err
+	}
+
+	variants, err := FindImageVariants(ctx, db, []int{imageId})
+	if err != nil {
+		return nil, err
+	}
+
+	img.Variants = variants[imageId]
+	if img.Variants == nil {
+		img.Variants = []ImageVariant{}
+	}
+
+	return &img, nil
+}
+
+// InsertImage inserts img into db. The id of the image is returned.
+func InsertImage(ctx context.Context, db DBTX, img Image) (int, error) {
+	query := `
+		INSERT INTO images (
+			filename,
+			url,
+			alt,
+			content_type,
+			size_bytes,
+			width,
+			height,
+			uploaded_by,
+			storage_key,
+			content_hash
+		) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )
+	`
+	result, err := db.ExecContext(ctx, query,
+		img.Filename,
+		img.Url,
+		img.Alt,
+		img.ContentType,
+		img.SizeBytes,
+		img.Width,
+		img.Height,
+		img.UploadedBy,
+		img.StorageKey,
+		img.ContentHash,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert image", "error", err)
+		return 0, err
+	}
+
+	imageId, err := result.LastInsertId()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to retreive image id", "error", err)
+		return 0, err
+	}
+
+	return int(imageId), nil
+}
+
+// InsertImageWithVariants inserts img and its variants into db. The id of the
+// image is returned.
+func InsertImageWithVariants(ctx context.Context, db *sql.DB, img Image, variants []ImageVariant) (int, error) {
+	var imageId int
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		var err error
+		imageId, err = InsertImage(ctx, tx, img)
+		if err != nil {
+			return err
+		}
+
+		return InsertImageVariants(ctx, tx, imageId, variants)
+	})
+
+	return imageId, err
+}
+
+// FindImageByHash finds an uploaded image whose file has the hex encoded
+// SHA-256 hash contentHash and whose variants have exactly the names in
+// variantNames, so that copies of it get the variants they need. Identical
+// files uploaded as an avatar and as an event image have different variants.
+func FindImageByHash(ctx context.Context, db *sql.DB, contentHash string, variantNames []string) (*Image, error) {
+	names := slices.Clone(variantNames)
+	slices.Sort(names)
+
+	query := `
+		SELECT ` + imageColumns + ` FROM images
+		WHERE content_hash = ?
+			AND (
+				SELECT GROUP_CONCAT(DISTINCT image_variants.name ORDER BY image_variants.name SEPARATOR ',')
+				FROM image_variants
+				WHERE image_variants.image_id = images.id
+			) = ?
+		ORDER BY images.id
+		LIMIT 1
+	`
+
+	img, err := scanImage(db.QueryRowContext(ctx, query, contentHash, strings.Join(names, ",")))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrImageNotFound
+		}
+		logging.FromContext(ctx).Error("failed to find image by hash", "error", err)
+
+		return nil, err
+	}
+
+	return &img, nil
+}
+
+// InsertImageCopy inserts img into db sharing the files and variants of the
+// image sourceId, for uploads identical to it. ErrImageNotFound is returned
+// if the source image was removed in the meantime. The id of the image is
+// returned.
+func InsertImageCopy(ctx context.Context, db *sql.DB, sourceId int, img Image) (int, error) {
+	var imageId int
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		// Lock the source image so that it can't be garbage collected,
+		// along with its files, before the copy is committed.
+		query := `SELECT ` + imageColumns + ` FROM images WHERE id = ? FOR SHARE`
+		source, err := scanImage(tx.QueryRowContext(ctx, query, sourceId))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrImageNotFound
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to lock image", "error", err, "id", sourceId)
+			return err
+		}
+
+		img.Url = source.Url
+		img.ContentType = source.ContentType
+		img.SizeBytes = source.SizeBytes
+		img.Width = source.Width
+		img.Height = source.Height
+		img.StorageKey = source.StorageKey
+		img.ContentHash = source.ContentHash
+
+		imageId, err = InsertImage(ctx, tx, img)
+		if err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO image_variants (image_id, name, content_type, width, height, size_bytes, storage_key, url)
+			SELECT ?, name, content_type, width, height, size_bytes, storage_key, url
+			FROM image_variants
+			WHERE image_id = ?
+		`
+		_, err = tx.ExecContext(ctx, query, imageId, sourceId)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to copy image variants", "error", err, "image_id", sourceId)
+		}
+
+		return err
+	})
+
+	return imageId, err
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// imageReferences lists the columns referencing images. An image is garbage
+// once none of them references it. Event revisions don't count, or images
+// would never be collected; rolling back to a revision whose image is gone
+// restores the event without an image.
+var imageReferences = []struct {
+	table  string
+	column string
+}{
+	{"events", "image_id"},
+	{"users", "avatar_image_id"},
+	{"organizations", "logo_image_id"},
+	{"event_images", "image_id"},
+}
+
+// unreferencedImage is a condition on images matching images no column in
+// imageReferences references.
+func unreferencedImage() string {
+	condition := "images.storage_key IS NOT NULL"
+	for _, ref := range imageReferences {
+		condition += ` AND NOT EXISTS (SELECT 1 FROM ` + ref.table +
+			` WHERE ` + ref.table + `.` + ref.column + ` = images.id)`
+	}
+
+	return condition
+}
+
+// FileRemover removes stored files, such as a storage.Storage.
+type FileRemover interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// CollectImageGarbage removes uploaded images created before cutoff that are
+// no longer referenced, in batches of batchSize, until none are left. Their
+// files are removed from files unless an identical upload still uses them.
+// The number of images removed is returned.
+//
+// Images uploaded since cutoff are kept even when unreferenced, giving
+// clients time to attach them to an event, user or organization.
+func CollectImageGarbage(ctx context.Context, db *sql.DB, files FileRemover, cutoff time.Time, batchSize int) (int, error) {
+	removed := 0
+	for {
+		query := `SELECT images.id FROM images WHERE images.created_at < ? AND ` + unreferencedImage() +
+			` ORDER BY images.id LIMIT ?`
+		rows, err := db.QueryContext(ctx, query, cutoff, batchSize)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to find unreferenced images", "error", err)
+			return removed, err
+		}
+
+		imageIds := []int{}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return removed, err
+			}
+			imageIds = append(imageIds, id)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			logging.FromContext(ctx).Error("error encountered while iterating over image rows", "error", err)
+			return removed, err
+		}
+
+		batchRemoved := 0
+		for _, id := range imageIds {
+			keys, err := deleteUnreferencedImage(ctx, db, id)
+			if err != nil {
+				return removed, err
+			}
+
+			if keys == nil {
+				continue
+			}
+			batchRemoved++
+
+			for _, key := range keys {
+				if err := files.Delete(ctx, key); err != nil {
+					logging.FromContext(ctx).Error("failed to delete image file", "error", err, "key", key)
+				}
+			}
+		}
+		removed += batchRemoved
+
+		// Stop when every image left was referenced in the meantime, or
+		// they would be found again.
+		if len(imageIds) < batchSize || batchRemoved == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// deleteUnreferencedImage deletes the image imageId, and its variants, unless
+// it has been referenced since it was found. The storage keys of the image's
+// files which no other image uses are returned, or nil if the image wasn't
+// deleted.
+func deleteUnreferencedImage(ctx context.Context, db *sql.DB, imageId int) ([]string, error) {
+	var keys []string
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		img, err := FindImageById(ctx, tx, imageId)
+		if errors.Is(err, ErrImageNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		candidates := []string{*img.StorageKey}
+		for _, variant := range img.Variants {
+			candidates = append(candidates, variant.StorageKey)
+		}
+
+		query := `DELETE FROM images WHERE images.id = ? AND ` + unreferencedImage()
+		result, err := tx.ExecContext(ctx, query, imageId)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to delete image", "error", err, "id", imageId)
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+
+		keys = []string{}
+		for _, key := range candidates {
+			query := `
+				SELECT
+					(SELECT COUNT(*) FROM images WHERE storage_key = ?) +
+					(SELECT COUNT(*) FROM image_variants WHERE storage_key = ?)
+			`
+			var uses int
+			if err := tx.QueryRowContext(ctx, query, key, key).Scan(&uses); err != nil {
+				logging.FromContext(ctx).Error("failed to count uses of image file", "error", err, "key", key)
+				return err
+			}
+
+			if uses == 0 {
+				keys = append(keys, key)
+			}
+		}
+
+		return nil
+	})
+
+	return keys, err
+}
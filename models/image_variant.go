@@ -0,0 +1,250 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// ImageVariant is a resized or re-encoded copy of an image.
+type ImageVariant struct {
+	Id      int `json:"id"`
+	ImageId int `json:"image_id"`
+	// Name is the size of the variant, such as "thumbnail", "card" or
+	// "hero".
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	SizeBytes   int    `json:"size_bytes"`
+	Url         string `json:"url"`
+	StorageKey  string `json:"-"`
+}
+
+// sameAspectRatio reports whether the variant has the aspect ratio of img,
+// allowing for the rounding of its height. Cropped variants, such as square
+// thumbnails, can't be part of the image's srcset.
+func (v ImageVariant) sameAspectRatio(img *Image) bool {
+	diff := v.Width*img.Height - v.Height*img.Width
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= img.Width+img.Height
+}
+
+// ImageSources lists the files of an image, ready to be used in an img or
+// picture element.
+type ImageSources struct {
+	Id     int    `json:"id"`
+	Url    string `json:"url"`
+	Alt    string `json:"alt"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Variants maps variant names to their URL for each content type, such
+	// as variants["thumbnail"]["image/webp"].
+	Variants map[string]map[string]string `json:"variants"`
+	// Srcset maps content types to a srcset listing every width the image
+	// is available in, such as "/uploads/a-card.jpg 600w, ...".
+	Srcset map[string]string `json:"srcset"`
+}
+
+// NewImageSources returns the sources of img given its variants.
+func NewImageSources(img *Image, variants []ImageVariant) *ImageSources {
+	sources := &ImageSources{
+		Id:       img.Id,
+		Url:      img.Url,
+		Alt:      img.Alt,
+		Width:    img.Width,
+		Height:   img.Height,
+		Variants: map[string]map[string]string{},
+		Srcset:   map[string]string{},
+	}
+
+	widths := map[string]map[int]string{}
+	addWidth := func(contentType string, width int, url string) {
+		if widths[contentType] == nil {
+			widths[contentType] = map[int]string{}
+		}
+		widths[contentType][width] = url
+	}
+
+	if img.ContentType != "" {
+		addWidth(img.ContentType, img.Width, img.Url)
+	}
+
+	for _, variant := range variants {
+		if sources.Variants[variant.Name] == nil {
+			sources.Variants[variant.Name] = map[string]string{}
+		}
+		sources.Variants[variant.Name][variant.ContentType] = variant.Url
+
+		if variant.sameAspectRatio(img) {
+			addWidth(variant.ContentType, variant.Width, variant.Url)
+		}
+	}
+
+	for contentType, urls := range widths {
+		sorted := []int{}
+		for width := range urls {
+			sorted = append(sorted, width)
+		}
+		sort.Ints(sorted)
+
+		candidates := []string{}
+		for _, width := range sorted {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", urls[width], width))
+		}
+		sources.Srcset[contentType] = strings.Join(candidates, ", ")
+	}
+
+	return sources
+}
+
+// InsertImageVariants inserts the variants of the image imageId into db.
+func InsertImageVariants(ctx context.Context, db DBTX, imageId int, variants []ImageVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO image_variants (
+			image_id,
+			name,
+			content_type,
+			width,
+			height,
+			size_bytes,
+			storage_key,
+			url
+		) VALUES `
+	args := []any{}
+	for i, variant := range variants {
+		if i > 0 {
+			query += `, `
+		}
+		query += `(?, ?, ?, ?, ?, ?, ?, ?)`
+		args = append(args,
+			imageId,
+			variant.Name,
+			variant.ContentType,
+			variant.Width,
+			variant.Height,
+			variant.SizeBytes,
+			variant.StorageKey,
+			variant.Url,
+		)
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert image variants", "error", err, "image_id", imageId)
+		return err
+	}
+
+	return nil
+}
+
+// FindImageVariants finds the variants of each of the images imageIds.
+func FindImageVariants(ctx context.Context, db DBTX, imageIds []int) (map[int][]ImageVariant, error) {
+	variants := map[int][]ImageVariant{}
+	if len(imageIds) == 0 {
+		return variants, nil
+	}
+
+	args := []any{}
+	for _, id := range imageIds {
+		args = append(args, id)
+	}
+
+	query := `
+		SELECT id, image_id, name, content_type, width, height, size_bytes, storage_key, url
+		FROM image_variants
+		WHERE image_id IN (` + placeholders(len(imageIds)) + `)
+		ORDER BY image_id, width
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find image variants", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant ImageVariant
+		err := rows.Scan(
+			&variant.Id,
+			&variant.ImageId,
+			&variant.Name,
+			&variant.ContentType,
+			&variant.Width,
+			&variant.Height,
+			&variant.SizeBytes,
+			&variant.StorageKey,
+			&variant.Url,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		variants[variant.ImageId] = append(variants[variant.ImageId], variant)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over image variant rows", "error", err)
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+// FindImageSources finds the images imageIds along with their variants.
+func FindImageSources(ctx context.Context, db *sql.DB, imageIds []int) (map[int]*ImageSources, error) {
+	sources := map[int]*ImageSources{}
+	if len(imageIds) == 0 {
+		return sources, nil
+	}
+
+	args := []any{}
+	for _, id := range imageIds {
+		args = append(args, id)
+	}
+
+	query := `SELECT ` + imageColumns + ` FROM images WHERE id IN (` + placeholders(len(imageIds)) + `)`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find images", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []Image{}
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over image rows", "error", err)
+		return nil, err
+	}
+
+	variants, err := FindImageVariants(ctx, db, imageIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range images {
+		sources[images[i].Id] = NewImageSources(&images[i], variants[images[i].Id])
+	}
+
+	return sources, nil
+}
@@ -3,30 +3,393 @@ package models
 import (
 	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+var (
+	ErrLocationNotFound = errors.New("location not found")
+	ErrLocationInUse    = errors.New("location is used by one or more events")
 )
 
 type Location struct {
-	Id      int    `json:"id"`
-	Name    string `json:"name"`
-	Address string `json:"address"`
-	MapURL  string `json:"map_url"`
+	Id            int           `json:"id"`
+	Name          string        `json:"name"`
+	Address       string        `json:"address"`
+	MapURL        string        `json:"map_url"`
+	Latitude      *float64      `json:"latitude"`
+	Longitude     *float64      `json:"longitude"`
+	Accessibility Accessibility `json:"accessibility"`
+	// Capacity is the number of people the venue holds.
+	Capacity     *int    `json:"capacity"`
+	ParkingNotes *string `json:"parking_notes"`
+	TransitNotes *string `json:"transit_notes"`
+	DeletedAt    *string `json:"deleted_at,omitempty"`
+	// Version is incremented on every change and used to detect concurrent
+	// updates.
+	Version int `json:"version"`
+}
+
+// Accessibility lists the accessibility features of a venue. A nil feature
+// means it isn't known whether the venue has it.
+type Accessibility struct {
+	StepFreeAccess     *bool `json:"step_free_access"`
+	Elevator           *bool `json:"elevator"`
+	AccessibleRestroom *bool `json:"accessible_restroom"`
+	// AslAvailable means American Sign Language interpretation is available.
+	AslAvailable *bool `json:"asl_available"`
+}
+
+// locationColumns lists the locations columns in the order scanLocation
+// expects them. They are qualified so that they can be selected alongside
+// joined tables.
+const locationColumns = `
+	locations.id,
+	locations.name,
+	locations.address,
+	COALESCE(locations.map_url, ''),
+	locations.latitude,
+	locations.longitude,
+	locations.step_free_access,
+	locations.elevator,
+	locations.accessible_restroom,
+	locations.asl_available,
+	locations.capacity,
+	locations.parking_notes,
+	locations.transit_notes,
+	locations.deleted_at,
+	locations.version
+`
+
+// scanLocation scans a row selected with locationColumns into a Location.
+func scanLocation(row rowScanner) (Location, error) {
+	var loc Location
+	err := row.Scan(
+		&loc.Id,
+		&loc.Name,
+		&loc.Address,
+		&loc.MapURL,
+		&loc.Latitude,
+		&loc.Longitude,
+		&loc.Accessibility.StepFreeAccess,
+		&loc.Accessibility.Elevator,
+		&loc.Accessibility.AccessibleRestroom,
+		&loc.Accessibility.AslAvailable,
+		&loc.Capacity,
+		&loc.ParkingNotes,
+		&loc.TransitNotes,
+		&loc.DeletedAt,
+		&loc.Version,
+	)
+
+	return loc, err
+}
+
+// FindLocationById finds a location in db by its id locationID. A soft-deleted
+// location is only found when includeDeleted is true.
+func FindLocationById(ctx context.Context, db DBTX, locationID int, includeDeleted bool) (*Location, error) {
+	query := "SELECT " + locationColumns + " FROM locations WHERE locations.id = ?"
+	if !includeDeleted {
+		query += " AND locations.deleted_at IS NULL"
+	}
+
+	loc, err := scanLocation(db.QueryRowContext(ctx, query, locationID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLocationNotFound
+		}
+		logging.FromContext(ctx).Error("failed to find location by id", "error", err, "id", locationID)
+
+		return nil, err
+	}
+
+	return &loc, nil
+}
+
+// FindLocationsByIds finds the active locations with the given ids, keyed by
+// id. Ids without an active location are left out.
+func FindLocationsByIds(ctx context.Context, db *sql.DB, locationIDs []int) (map[int]*Location, error) {
+	locations := map[int]*Location{}
+	if len(locationIDs) == 0 {
+		return locations, nil
+	}
+
+	args := []any{}
+	for _, id := range locationIDs {
+		args = append(args, id)
+	}
+
+	query := "SELECT " + locationColumns + " FROM locations WHERE locations.deleted_at IS NULL AND locations.id IN (" +
+		placeholders(len(locationIDs)) + ")"
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find locations by ids", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		loc, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		locations[loc.Id] = &loc
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over location rows", "error", err)
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// FindLocations finds up to limit locations whose name or address contains
+// search, ordered by name. An empty search matches every location.
+// Soft-deleted locations are only returned when includeDeleted is true.
+func FindLocations(ctx context.Context, db *sql.DB, search string, limit int, includeDeleted bool) ([]Location, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		conditions = append(conditions, "(locations.name LIKE ? OR locations.address LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+
+	if !includeDeleted {
+		conditions = append(conditions, "locations.deleted_at IS NULL")
+	}
+
+	query := "SELECT " + locationColumns + " FROM locations"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY locations.name LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find locations", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []Location{}
+	for rows.Next() {
+		loc, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		locations = append(locations, loc)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over location rows", "error", err)
+		return nil, err
+	}
+
+	return locations, nil
 }
 
 func InsertLocation(ctx context.Context, db *sql.DB, loc Location) (int, error) {
-	query := "INSERT INTO locations (name, address, map_url) VALUES (?, ?, ?)"
+	query := `
+		INSERT INTO locations (
+			name,
+			address,
+			map_url,
+			latitude,
+			longitude,
+			coordinates,
+			step_free_access,
+			elevator,
+			accessible_restroom,
+			asl_available,
+			capacity,
+			parking_notes,
+			transit_notes,
+			name_key,
+			address_key
+		) VALUES ( ?, ?, ?, ?, ?, ST_PointFromText(?, 4326, 'axis-order=long-lat'), ?, ?, ?, ?, ?, ?, ?, ?, ? )
+	`
 
-	result, err := db.ExecContext(ctx, query, loc.Name, loc.Address, loc.MapURL)
+	result, err := db.ExecContext(ctx, query,
+		loc.Name,
+		loc.Address,
+		loc.MapURL,
+		loc.Latitude,
+		loc.Longitude,
+		pointWKT(loc.Latitude, loc.Longitude),
+		loc.Accessibility.StepFreeAccess,
+		loc.Accessibility.Elevator,
+		loc.Accessibility.AccessibleRestroom,
+		loc.Accessibility.AslAvailable,
+		loc.Capacity,
+		loc.ParkingNotes,
+		loc.TransitNotes,
+		NormalizeLocationName(loc.Name),
+		NormalizeAddress(loc.Address),
+	)
 	if err != nil {
-		log.Printf("failed to insert location details: %s\n", err)
+		logging.FromContext(ctx).Error("failed to insert location details", "error", err)
 		return 0, err
 	}
 
 	locationID, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("failed to retreive location id: %s\n", err)
+		logging.FromContext(ctx).Error("failed to retreive location id", "error", err)
 		return 0, err
 	}
 
 	return int(locationID), err
 }
+
+// UpdateLocation updates a location in db. The update only happens if the
+// location is still at loc.Version, ErrVersionMismatch is returned otherwise.
+func UpdateLocation(ctx context.Context, db *sql.DB, loc Location) error {
+	query := `
+		UPDATE locations SET
+			name = ?,
+			address = ?,
+			map_url = ?,
+			latitude = ?,
+			longitude = ?,
+			coordinates = ST_PointFromText(?, 4326, 'axis-order=long-lat'),
+			step_free_access = ?,
+			elevator = ?,
+			accessible_restroom = ?,
+			asl_available = ?,
+			capacity = ?,
+			parking_notes = ?,
+			transit_notes = ?,
+			name_key = ?,
+			address_key = ?,
+			version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL
+	`
+
+	result, err := db.ExecContext(ctx, query,
+		loc.Name,
+		loc.Address,
+		loc.MapURL,
+		loc.Latitude,
+		loc.Longitude,
+		pointWKT(loc.Latitude, loc.Longitude),
+		loc.Accessibility.StepFreeAccess,
+		loc.Accessibility.Elevator,
+		loc.Accessibility.AccessibleRestroom,
+		loc.Accessibility.AslAvailable,
+		loc.Capacity,
+		loc.ParkingNotes,
+		loc.TransitNotes,
+		NormalizeLocationName(loc.Name),
+		NormalizeAddress(loc.Address),
+		loc.Id,
+		loc.Version,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update location", "error", err, "location", loc)
+		return err
+	}
+
+	return locationVersionMatched(ctx, db, result, loc.Id)
+}
+
+// locationVersionMatched tells apart the reasons why a versioned statement on
+// the location locationID didn't affect any rows.
+func locationVersionMatched(ctx context.Context, db *sql.DB, result sql.Result, locationID int) error {
+	err := requireAffected(ctx, result, ErrVersionMismatch)
+	if !errors.Is(err, ErrVersionMismatch) {
+		return err
+	}
+
+	if _, err := FindLocationById(ctx, db, locationID, false); err != nil {
+		return err
+	}
+
+	return ErrVersionMismatch
+}
+
+// DeleteLocation soft deletes a location. The location is kept in db until it
+// is purged and can be brought back with RestoreLocation. Locations used by an
+// event can't be deleted, ErrLocationInUse is returned instead. The location
+// is only deleted if it is still at version, ErrVersionMismatch is returned
+// otherwise.
+func DeleteLocation(ctx context.Context, db *sql.DB, locationID, version int) error {
+	query := `
+		UPDATE locations SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ?
+			AND version = ?
+			AND deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM events WHERE events.location_id = ? AND events.deleted_at IS NULL
+			)
+	`
+
+	result, err := db.ExecContext(ctx, query, locationID, version, locationID)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete location", "error", err, "id", locationID)
+		return err
+	}
+
+	err = requireAffected(ctx, result, ErrLocationInUse)
+	if !errors.Is(err, ErrLocationInUse) {
+		return err
+	}
+
+	// Nothing was deleted, either because the location doesn't exist, was
+	// changed since version or is in use.
+	loc, err := FindLocationById(ctx, db, locationID, false)
+	if err != nil {
+		return err
+	}
+	if loc.Version != version {
+		return ErrVersionMismatch
+	}
+
+	return ErrLocationInUse
+}
+
+// RestoreLocation undoes the soft deletion of a location.
+func RestoreLocation(ctx context.Context, db *sql.DB, locationID int) error {
+	query := "UPDATE locations SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL"
+
+	result, err := db.ExecContext(ctx, query, locationID)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to restore location", "error", err, "id", locationID)
+		return err
+	}
+
+	return requireAffected(ctx, result, ErrLocationNotFound)
+}
+
+// PurgeDeletedLocations permanently removes locations that were soft deleted
+// before cutoff. Locations still referenced by an event are kept. The number of
+// locations removed is returned.
+func PurgeDeletedLocations(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM locations
+		WHERE deleted_at IS NOT NULL
+			AND deleted_at < ?
+			AND NOT EXISTS (SELECT 1 FROM events WHERE events.location_id = locations.id)
+	`
+
+	result, err := db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to purge deleted locations", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern so that s is
+// matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
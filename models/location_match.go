@@ -0,0 +1,321 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// Thresholds above which two locations are considered duplicates. Similarities
+// range from 0 (nothing in common) to 1 (identical once normalized).
+const (
+	duplicateAddressSimilarity = 0.85
+	duplicateNameSimilarity    = 0.9
+	// Locations with near identical names only need roughly similar
+	// addresses, to catch "Main St" vs "Main St Suite 2".
+	duplicateNamedAddressSimilarity = 0.5
+	// duplicateDistanceKm is how close two geocoded locations have to be to
+	// be the same venue.
+	duplicateDistanceKm = 0.05
+)
+
+// addressAbbreviations maps common address words to their USPS abbreviation
+// so that "123 Main Street" and "123 main st." normalize the same.
+var addressAbbreviations = map[string]string{
+	"street":    "st",
+	"avenue":    "ave",
+	"road":      "rd",
+	"boulevard": "blvd",
+	"drive":     "dr",
+	"lane":      "ln",
+	"court":     "ct",
+	"place":     "pl",
+	"highway":   "hwy",
+	"parkway":   "pkwy",
+	"suite":     "ste",
+	"apartment": "apt",
+	"building":  "bldg",
+	"floor":     "fl",
+	"north":     "n",
+	"south":     "s",
+	"east":      "e",
+	"west":      "w",
+}
+
+// LocationMatch is an existing location that looks like a duplicate of
+// another one.
+type LocationMatch struct {
+	Location
+	// Similarity ranges from 0 to 1, higher is more alike.
+	Similarity float64 `json:"similarity"`
+}
+
+// NormalizeLocationName lowercases name and strips punctuation and extra
+// whitespace.
+func NormalizeLocationName(name string) string {
+	return strings.Join(normalizeWords(name), " ")
+}
+
+// NormalizeAddress is like NormalizeLocationName but also abbreviates common
+// address words.
+func NormalizeAddress(address string) string {
+	words := normalizeWords(address)
+	for i, word := range words {
+		if abbr, ok := addressAbbreviations[word]; ok {
+			words[i] = abbr
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+func normalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// FindDuplicateLocations finds active locations that look like duplicates of
+// loc, most similar first. loc itself is left out if it has an id.
+//
+// Only locations whose normalized name or address starts with the same word as
+// loc's, or that are close to it, are compared, so that every location doesn't
+// have to be loaded.
+func FindDuplicateLocations(ctx context.Context, db DBTX, loc Location) ([]LocationMatch, error) {
+	name := NormalizeLocationName(loc.Name)
+	address := NormalizeAddress(loc.Address)
+
+	candidates := []string{}
+	args := []any{loc.Id}
+	if word, _, _ := strings.Cut(name, " "); word != "" {
+		candidates = append(candidates, "locations.name_key LIKE ?")
+		args = append(args, word+"%")
+	}
+	if word, _, _ := strings.Cut(address, " "); word != "" {
+		candidates = append(candidates, "locations.address_key LIKE ?")
+		args = append(args, word+"%")
+	}
+	if loc.Latitude != nil && loc.Longitude != nil {
+		center := GeoPoint{Latitude: *loc.Latitude, Longitude: *loc.Longitude}
+		within, withinArgs := withinBoundingBoxes("locations.coordinates", center, duplicateDistanceKm)
+		candidates = append(candidates, "(locations.latitude IS NOT NULL AND "+within+")")
+		args = append(args, withinArgs...)
+	}
+
+	if len(candidates) == 0 {
+		return []LocationMatch{}, nil
+	}
+
+	query := "SELECT " + locationColumns + " FROM locations WHERE locations.deleted_at IS NULL AND locations.id != ?" +
+		" AND (" + strings.Join(candidates, " OR ") + ")"
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find duplicate locations", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []LocationMatch{}
+	for rows.Next() {
+		other, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		nameSim := similarity(name, NormalizeLocationName(other.Name))
+		addressSim := similarity(address, NormalizeAddress(other.Address))
+
+		duplicate := addressSim >= duplicateAddressSimilarity ||
+			nameSim >= duplicateNameSimilarity && addressSim >= duplicateNamedAddressSimilarity ||
+			withinKm(loc, other, duplicateDistanceKm)
+		if !duplicate {
+			continue
+		}
+
+		matches = append(matches, LocationMatch{
+			Location:   other,
+			Similarity: math.Max(addressSim, (nameSim+addressSim)/2),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over location rows", "error", err)
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+
+	return matches, nil
+}
+
+// similarity returns 1 minus the Levenshtein distance between a and b divided
+// by the length of the longer one.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the minimum number of single rune insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// withinKm reports whether both locations are geocoded and at most km apart.
+func withinKm(a, b Location, km float64) bool {
+	if a.Latitude == nil || a.Longitude == nil || b.Latitude == nil || b.Longitude == nil {
+		return false
+	}
+
+	const earthRadiusKm = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(*b.Latitude - *a.Latitude)
+	dLon := toRad(*b.Longitude - *a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(*a.Latitude))*math.Cos(toRad(*b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2*earthRadiusKm*math.Asin(math.Sqrt(h)) <= km
+}
+
+// MergeLocations moves every event at one of duplicateIds to the location
+// survivorId and soft deletes the duplicates, in a single transaction. Each
+// active event moved gets a new revision made by the user userId. The number
+// of events moved is returned.
+func MergeLocations(ctx context.Context, db *sql.DB, survivorId int, duplicateIds []int, userId *int) (int64, error) {
+	var moved int64
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := FindLocationById(ctx, tx, survivorId, false); err != nil {
+			return err
+		}
+
+		for _, id := range duplicateIds {
+			if _, err := FindLocationById(ctx, tx, id, false); err != nil {
+				return err
+			}
+		}
+
+		args := []any{survivorId}
+		for _, id := range duplicateIds {
+			args = append(args, id)
+		}
+
+		eventIds, err := lockActiveEventsAt(ctx, tx, duplicateIds)
+		if err != nil {
+			return err
+		}
+
+		for _, eventId := range eventIds {
+			if err := recordInitialEventRevision(ctx, tx, eventId); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			UPDATE events SET
+				location_id = ?,
+				version = version + 1
+			WHERE location_id IN (` + placeholders(len(duplicateIds)) + `)
+		`
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to move events to merged location", "error", err, "location_id", survivorId)
+			return err
+		}
+
+		moved, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE locations SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id IN (` + placeholders(len(duplicateIds)) + `)
+		`
+		_, err = tx.ExecContext(ctx, query, args[1:]...)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to delete merged locations", "error", err, "ids", duplicateIds)
+			return err
+		}
+
+		for _, eventId := range eventIds {
+			if _, err := recordEventRevision(ctx, tx, eventId, userId, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return moved, err
+}
+
+// lockActiveEventsAt returns the ids of the active events at one of
+// locationIds, locked until tx ends.
+func lockActiveEventsAt(ctx context.Context, tx *sql.Tx, locationIds []int) ([]int, error) {
+	args := []any{}
+	for _, id := range locationIds {
+		args = append(args, id)
+	}
+
+	query := `
+		SELECT id FROM events
+		WHERE location_id IN (` + placeholders(len(locationIds)) + `) AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to lock events at locations", "error", err, "location_ids", locationIds)
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventIds := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		eventIds = append(eventIds, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over event rows", "error", err)
+		return nil, err
+	}
+
+	return eventIds, nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// ErrVersionMismatch is returned when a row was changed since the version the
+// caller based its change on.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so functions accepting it
+// can run on their own or as part of a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a transaction which is committed if fn succeeds and rolled
+// back otherwise.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Error("failed to commit transaction", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// requireAffected returns notFound when result reports that no rows were
+// affected by a statement.
+func requireAffected(ctx context.Context, result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to retreive affected rows", "error", err)
+		return err
+	}
+
+	if n == 0 {
+		return notFound
+	}
+
+	return nil
+}
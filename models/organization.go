@@ -0,0 +1,226 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationInUse    = errors.New("organization is hosting one or more events")
+)
+
+type Organization struct {
+	Id           int     `json:"id"`
+	Name         string  `json:"name"`
+	Description  *string `json:"description"`
+	Website      *string `json:"website"`
+	LogoImageId  *int    `json:"logo_image_id"`
+	ContactEmail *string `json:"contact_email"`
+	// SocialLinks maps social networks, such as "instagram", to the URL of
+	// the organization's profile on them.
+	SocialLinks map[string]string `json:"social_links"`
+	CreatedAt   string            `json:"created_at"`
+	UpdatedAt   string            `json:"updated_at"`
+}
+
+// organizationColumns lists the organizations columns in the order
+// scanOrganization expects them.
+const organizationColumns = `
+	organizations.id,
+	organizations.name,
+	organizations.description,
+	organizations.website,
+	organizations.logo_image_id,
+	organizations.contact_email,
+	organizations.social_links,
+	organizations.created_at,
+	organizations.updated_at
+`
+
+// scanOrganization scans a row selected with organizationColumns into an
+// Organization.
+func scanOrganization(row rowScanner) (Organization, error) {
+	var org Organization
+	var socialLinks []byte
+
+	err := row.Scan(
+		&org.Id,
+		&org.Name,
+		&org.Description,
+		&org.Website,
+		&org.LogoImageId,
+		&org.ContactEmail,
+		&socialLinks,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	)
+	if err != nil {
+		return org, err
+	}
+
+	org.SocialLinks = map[string]string{}
+	if socialLinks != nil {
+		err = json.Unmarshal(socialLinks, &org.SocialLinks)
+	}
+
+	return org, err
+}
+
+// FindOrganizations finds up to limit organizations ordered by name.
+func FindOrganizations(ctx context.Context, db *sql.DB, limit int) ([]Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations ORDER BY name LIMIT ?`
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find organizations", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		orgs = append(orgs, org)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over organization rows", "error", err)
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// FindOrganizationById finds an organization in db by its id orgId.
+func FindOrganizationById(ctx context.Context, db DBTX, orgId int) (*Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE id = ?`
+
+	org, err := scanOrganization(db.QueryRowContext(ctx, query, orgId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		logging.FromContext(ctx).Error("failed to find organization by id", "error", err, "id", orgId)
+
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// InsertOrganization inserts org into db. The id of the organization is
+// returned.
+func InsertOrganization(ctx context.Context, db DBTX, org Organization) (int, error) {
+	socialLinks, err := json.Marshal(org.SocialLinks)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO organizations (
+			name,
+			description,
+			website,
+			logo_image_id,
+			contact_email,
+			social_links
+		) VALUES ( ?, ?, ?, ?, ?, ? )
+	`
+	result, err := db.ExecContext(ctx, query,
+		org.Name,
+		org.Description,
+		org.Website,
+		org.LogoImageId,
+		org.ContactEmail,
+		socialLinks,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert organization", "error", err)
+		return 0, err
+	}
+
+	orgId, err := result.LastInsertId()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to retreive organization id", "error", err)
+		return 0, err
+	}
+
+	return int(orgId), nil
+}
+
+// UpdateOrganization updates org in db.
+func UpdateOrganization(ctx context.Context, db *sql.DB, org Organization) error {
+	if _, err := FindOrganizationById(ctx, db, org.Id); err != nil {
+		return err
+	}
+
+	socialLinks, err := json.Marshal(org.SocialLinks)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE organizations SET
+			name = ?,
+			description = ?,
+			website = ?,
+			logo_image_id = ?,
+			contact_email = ?,
+			social_links = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err = db.ExecContext(ctx, query,
+		org.Name,
+		org.Description,
+		org.Website,
+		org.LogoImageId,
+		org.ContactEmail,
+		socialLinks,
+		org.Id,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update organization", "error", err, "id", org.Id)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteOrganization deletes an organization using orgId. Organizations that
+// host or co-host an event, even a deleted one, can't be deleted and
+// ErrOrganizationInUse is returned instead.
+func DeleteOrganization(ctx context.Context, db *sql.DB, orgId int) error {
+	query := `
+		DELETE FROM organizations
+		WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM events WHERE events.organization_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM event_organizations WHERE organization_id = ?)
+	`
+	result, err := db.ExecContext(ctx, query, orgId, orgId, orgId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete organization", "error", err, "id", orgId)
+		return err
+	}
+
+	err = requireAffected(ctx, result, ErrOrganizationInUse)
+	if !errors.Is(err, ErrOrganizationInUse) {
+		return err
+	}
+
+	// Nothing was deleted, either because the organization doesn't exist or
+	// because it is in use.
+	if _, err := FindOrganizationById(ctx, db, orgId); err != nil {
+		return err
+	}
+
+	return ErrOrganizationInUse
+}
@@ -0,0 +1,388 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+// Roles of users within an organization. Owners manage the organization and
+// its members, managers manage its events and viewers can only see them.
+const (
+	OrgRoleOwner   = "owner"
+	OrgRoleManager = "manager"
+	OrgRoleViewer  = "viewer"
+)
+
+var OrgRoles = []string{OrgRoleOwner, OrgRoleManager, OrgRoleViewer}
+
+// InvitationTTL is how long an invitation can be accepted for.
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrMemberNotFound          = errors.New("organization member not found")
+	ErrLastOwner               = errors.New("an organization must keep at least one owner")
+	ErrInvitationNotFound      = errors.New("invitation not found, already accepted or expired")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+)
+
+// CanManageEvents reports whether an organization role allows creating and
+// editing the organization's events.
+func CanManageEvents(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleManager
+}
+
+type OrganizationMember struct {
+	OrganizationId int    `json:"organization_id"`
+	UserId         int    `json:"user_id"`
+	Role           string `json:"role"`
+	Username       string `json:"username"`
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type OrganizationInvitation struct {
+	Id             int     `json:"id"`
+	OrganizationId int     `json:"organization_id"`
+	Email          string  `json:"email"`
+	Role           string  `json:"role"`
+	InvitedBy      *int    `json:"invited_by"`
+	CreatedAt      string  `json:"created_at"`
+	ExpiresAt      string  `json:"expires_at"`
+	AcceptedAt     *string `json:"accepted_at"`
+}
+
+// FindOrganizationMembers finds the members of the organization orgId ordered
+// by username. Soft-deleted users are left out.
+func FindOrganizationMembers(ctx context.Context, db *sql.DB, orgId int) ([]OrganizationMember, error) {
+	query := `
+		SELECT
+			organization_members.organization_id,
+			organization_members.user_id,
+			organization_members.role,
+			users.username,
+			users.first_name,
+			users.last_name,
+			organization_members.created_at
+		FROM organization_members
+		JOIN users ON users.id = organization_members.user_id
+		WHERE organization_members.organization_id = ? AND users.deleted_at IS NULL
+		ORDER BY users.username
+	`
+	rows, err := db.QueryContext(ctx, query, orgId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find organization members", "error", err, "organization_id", orgId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []OrganizationMember{}
+	for rows.Next() {
+		var member OrganizationMember
+		err := rows.Scan(
+			&member.OrganizationId,
+			&member.UserId,
+			&member.Role,
+			&member.Username,
+			&member.FirstName,
+			&member.LastName,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over organization member rows", "error", err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// FindOrganizationRoles returns the role of the user userId in each of the
+// organizations orgIds it is a member of.
+func FindOrganizationRoles(ctx context.Context, db DBTX, userId int, orgIds []int) (map[int]string, error) {
+	roles := map[int]string{}
+	if len(orgIds) == 0 {
+		return roles, nil
+	}
+
+	args := []any{userId}
+	for _, id := range orgIds {
+		args = append(args, id)
+	}
+
+	query := `SELECT organization_id, role FROM organization_members WHERE user_id = ? AND organization_id IN (` +
+		placeholders(len(orgIds)) + `)`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find organization roles", "error", err, "user_id", userId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orgId int
+		var role string
+		if err := rows.Scan(&orgId, &role); err != nil {
+			return nil, err
+		}
+
+		roles[orgId] = role
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over organization role rows", "error", err)
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// UpdateOrganizationMember changes the role of the user userId in the
+// organization orgId. The last owner of an organization can't be demoted.
+func UpdateOrganizationMember(ctx context.Context, db *sql.DB, orgId, userId int, role string) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		if role != OrgRoleOwner {
+			if err := requireOtherOwner(ctx, tx, orgId, userId); err != nil {
+				return err
+			}
+		}
+
+		query := `UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?`
+		result, err := tx.ExecContext(ctx, query, role, orgId, userId)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to update organization member", "error", err, "organization_id", orgId, "user_id", userId)
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// Setting a member's current role affects no rows either.
+		if n == 0 {
+			_, err = findOrganizationRole(ctx, tx, orgId, userId)
+		}
+
+		return err
+	})
+}
+
+// RemoveOrganizationMember removes the user userId from the organization
+// orgId. The last owner of an organization can't be removed.
+func RemoveOrganizationMember(ctx context.Context, db *sql.DB, orgId, userId int) error {
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		if err := requireOtherOwner(ctx, tx, orgId, userId); err != nil {
+			return err
+		}
+
+		query := `DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?`
+		result, err := tx.ExecContext(ctx, query, orgId, userId)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to remove organization member", "error", err, "organization_id", orgId, "user_id", userId)
+			return err
+		}
+
+		return requireAffected(ctx, result, ErrMemberNotFound)
+	})
+}
+
+// requireOtherOwner returns ErrLastOwner when the user userId is the only
+// owner of the organization orgId. The owners are locked until tx ends so that
+// two owners can't step down at the same time.
+func requireOtherOwner(ctx context.Context, tx *sql.Tx, orgId, userId int) error {
+	role, err := findOrganizationRole(ctx, tx, orgId, userId)
+	if err != nil || role != OrgRoleOwner {
+		return err
+	}
+
+	query := `
+		SELECT COUNT(*) FROM organization_members
+		WHERE organization_id = ? AND role = ? AND user_id != ?
+		FOR UPDATE
+	`
+	var others int
+	err = tx.QueryRowContext(ctx, query, orgId, OrgRoleOwner, userId).Scan(&others)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to count organization owners", "error", err, "organization_id", orgId)
+		return err
+	}
+
+	if others == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+func findOrganizationRole(ctx context.Context, db DBTX, orgId, userId int) (string, error) {
+	roles, err := FindOrganizationRoles(ctx, db, userId, []int{orgId})
+	if err != nil {
+		return "", err
+	}
+
+	role, ok := roles[orgId]
+	if !ok {
+		return "", ErrMemberNotFound
+	}
+
+	return role, nil
+}
+
+// NewInvitationToken generates a random invitation token along with the hash
+// stored for it.
+func NewInvitationToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = hex.EncodeToString(b)
+
+	return token, HashInvitationToken(token), nil
+}
+
+// HashInvitationToken returns the hash stored for an invitation token.
+func HashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// InsertOrganizationInvitation inserts inv into db, identified by the hash of
+// its token. The invitation expires after InvitationTTL. The id of the
+// invitation is returned.
+func InsertOrganizationInvitation(ctx context.Context, db *sql.DB, inv OrganizationInvitation, tokenHash string) (int, error) {
+	query := `
+		INSERT INTO organization_invitations (
+			organization_id,
+			email,
+			role,
+			token_hash,
+			invited_by,
+			expires_at
+		) VALUES ( ?, ?, ?, ?, ?, CURRENT_TIMESTAMP + INTERVAL ? SECOND )
+	`
+	result, err := db.ExecContext(ctx, query,
+		inv.OrganizationId,
+		inv.Email,
+		inv.Role,
+		tokenHash,
+		inv.InvitedBy,
+		int(InvitationTTL.Seconds()),
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to insert organization invitation", "error", err)
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to retreive organization invitation id", "error", err)
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// FindOrganizationInvitationById finds an invitation in db by its id.
+func FindOrganizationInvitationById(ctx context.Context, db DBTX, id int) (*OrganizationInvitation, error) {
+	query := `
+		SELECT id, organization_id, email, role, invited_by, created_at, expires_at, accepted_at
+		FROM organization_invitations
+		WHERE id = ?
+	`
+	var inv OrganizationInvitation
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&inv.Id,
+		&inv.OrganizationId,
+		&inv.Email,
+		&inv.Role,
+		&inv.InvitedBy,
+		&inv.CreatedAt,
+		&inv.ExpiresAt,
+		&inv.AcceptedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+		logging.FromContext(ctx).Error("failed to find organization invitation", "error", err, "id", id)
+
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// AcceptOrganizationInvitation makes user a member of the organization they
+// were invited to with the token hashed as tokenHash. The invitation must be
+// pending and sent to the user's email address. Accepting an invitation only
+// ever raises the role of an existing member, never lowers it.
+func AcceptOrganizationInvitation(ctx context.Context, db *sql.DB, tokenHash string, user *User) (*OrganizationInvitation, error) {
+	var inv OrganizationInvitation
+
+	err := inTx(ctx, db, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, organization_id, email, role
+			FROM organization_invitations
+			WHERE token_hash = ? AND accepted_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			FOR UPDATE
+		`
+		err := tx.QueryRowContext(ctx, query, tokenHash).Scan(&inv.Id, &inv.OrganizationId, &inv.Email, &inv.Role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvitationNotFound
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to find organization invitation", "error", err)
+			return err
+		}
+
+		if !strings.EqualFold(inv.Email, user.Email) {
+			return ErrInvitationEmailMismatch
+		}
+
+		// Roles are listed from highest to lowest, existing members keep the
+		// higher of their role and the invitation's.
+		query = `
+			INSERT INTO organization_members (organization_id, user_id, role)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE role = IF(
+				FIELD(VALUES(role), 'owner', 'manager', 'viewer') < FIELD(role, 'owner', 'manager', 'viewer'),
+				VALUES(role),
+				role
+			)
+		`
+		_, err = tx.ExecContext(ctx, query, inv.OrganizationId, user.ID, inv.Role)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to insert organization member", "error", err, "organization_id", inv.OrganizationId, "user_id", user.ID)
+			return err
+		}
+
+		query = `UPDATE organization_invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_by = ? WHERE id = ?`
+		_, err = tx.ExecContext(ctx, query, user.ID, inv.Id)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to mark organization invitation accepted", "error", err, "id", inv.Id)
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindOrganizationInvitationById(ctx, db, inv.Id)
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+var ErrRegistrationNotFound = errors.New("registration not found")
+
+// RegisterForEvent registers the user userId to attend the event eventId,
+// reporting whether the user wasn't registered already. Registering twice
+// has no effect.
+func RegisterForEvent(ctx context.Context, db *sql.DB, eventId, userId int) (bool, error) {
+	query := `INSERT IGNORE INTO event_registrations (event_id, user_id) VALUES (?, ?)`
+	result, err := db.ExecContext(ctx, query, eventId, userId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to register for event", "error", err, "event_id", eventId, "user_id", userId)
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to retreive affected rows", "error", err)
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// UnregisterFromEvent cancels the registration of the user userId for the
+// event eventId.
+func UnregisterFromEvent(ctx context.Context, db *sql.DB, eventId, userId int) error {
+	query := `DELETE FROM event_registrations WHERE event_id = ? AND user_id = ?`
+	result, err := db.ExecContext(ctx, query, eventId, userId)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to unregister from event", "error", err, "event_id", eventId, "user_id", userId)
+		return err
+	}
+
+	return requireAffected(ctx, result, ErrRegistrationNotFound)
+}
+
+// FindRegisteredEventIds returns which of eventIds the user userId is
+// registered for.
+func FindRegisteredEventIds(ctx context.Context, db *sql.DB, userId int, eventIds []int) (map[int]bool, error) {
+	registered := map[int]bool{}
+	if len(eventIds) == 0 {
+		return registered, nil
+	}
+
+	args := []any{userId}
+	for _, id := range eventIds {
+		args = append(args, id)
+	}
+
+	query := `SELECT event_id FROM event_registrations WHERE user_id = ? AND event_id IN (` +
+		placeholders(len(eventIds)) + `)`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to find registered events", "error", err, "user_id", userId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventId int
+		if err := rows.Scan(&eventId); err != nil {
+			return nil, err
+		}
+
+		registered[eventId] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("error encountered while iterating over registration rows", "error", err)
+		return nil, err
+	}
+
+	return registered, nil
+}
+
+// placeholders returns n comma separated query placeholders for use in an IN
+// clause.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -4,26 +4,67 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"time"
+
+	"github.com/somos831/somos-backend/logging"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// Ids of the roles seeded into user_roles.
+const (
+	RoleAdministrator = 1
+	RoleEditor        = 2
+	RoleMember        = 3
+	RoleDeveloper     = 4
+	RoleGuest         = 5
 )
 
 type User struct {
-	ID             int    `json:"id"`
-	Username       string `json:"username"`
-	Email          string `json:"email"`
-	Password       string `json:"password,omitempty"` // TODO: change to hashed when auth is implemented
-	FirstName      string `json:"first_name"`
-	LastName       string `json:"last_name"`
-	ProfilePicture string `json:"profile_picture"`
-	CreatedAt      string `json:"created_at,omitempty"`
-	UpdatedAt      string `json:"updated_at,omitempty"`
-	StatusID       int    `json:"status_id"`
-	RoleID         int    `json:"role_id"`
+	ID        int     `json:"id"`
+	Username  string  `json:"username"`
+	Email     string  `json:"email"`
+	Password  string  `json:"password,omitempty"` // TODO: change to hashed when auth is implemented
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	CreatedAt string  `json:"created_at,omitempty"`
+	UpdatedAt string  `json:"updated_at,omitempty"`
+	StatusID  int     `json:"status_id"`
+	RoleID    int     `json:"role_id"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
+	// Version is incremented on every change and used to detect concurrent
+	// updates.
+	Version int `json:"version"`
+	// AvatarImageId is the image uploaded as the user's avatar, if any. It
+	// can only be changed with SetUserAvatar.
+	AvatarImageId *int `json:"avatar_image_id"`
+	// AvatarUrl is the address of the user's avatar, a generated one for
+	// users who haven't uploaded any.
+	AvatarUrl string `json:"avatar_url,omitempty"`
+	// Avatar holds the files of the uploaded avatar.
+	Avatar *ImageSources `json:"avatar,omitempty"`
+}
+
+// IsAdmin reports whether the user has the administrator role.
+func (u *User) IsAdmin() bool {
+	return u.RoleID == RoleAdministrator
 }
 
-func FindUserByID(ctx context.Context, db *sql.DB, userID int) (*User, error) {
+// IsEditor reports whether the user can manage all events, which
+// administrators and editors can.
+func (u *User) IsEditor() bool {
+	return u.RoleID == RoleAdministrator || u.RoleID == RoleEditor
+}
 
-	row := db.QueryRowContext(ctx, `SELECT id, username, email, first_name, last_name, profile_picture, status_id, role_id FROM users WHERE id = ?`, userID)
+// FindUserByID finds a user in db by its id userID. A soft-deleted user is only
+// found when includeDeleted is true.
+func FindUserByID(ctx context.Context, db *sql.DB, userID int, includeDeleted bool) (*User, error) {
+
+	query := `SELECT id, username, email, first_name, last_name, status_id, role_id, deleted_at, version, avatar_image_id FROM users WHERE id = ?`
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	row := db.QueryRowContext(ctx, query, userID)
 
 	var user User
 	err := row.Scan(
@@ -32,16 +73,18 @@ func FindUserByID(ctx context.Context, db *sql.DB, userID int) (*User, error) {
 		&user.Email,
 		&user.FirstName,
 		&user.LastName,
-		&user.ProfilePicture,
 		&user.StatusID,
 		&user.RoleID,
+		&user.DeletedAt,
+		&user.Version,
+		&user.AvatarImageId,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
-		log.Println(err)
+		logging.FromContext(ctx).Error("failed to find user by id", "error", err, "id", userID)
 
 		return nil, err
 	}
@@ -52,37 +95,54 @@ func FindUserByID(ctx context.Context, db *sql.DB, userID int) (*User, error) {
 // TODO: will need to modify once we add authorization
 func InsertUser(ctx context.Context, db *sql.DB, user *User) (int, error) {
 
-	query := "INSERT INTO users (username, email, password, first_name, last_name, profile_picture, status_id, role_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	query := "INSERT INTO users (username, email, password, first_name, last_name, status_id, role_id) VALUES (?, ?, ?, ?, ?, ?, ?)"
 
-	result, err := db.ExecContext(ctx, query, user.Username, user.Email, user.Password, user.FirstName, user.LastName, user.ProfilePicture, user.StatusID, user.RoleID)
+	result, err := db.ExecContext(ctx, query, user.Username, user.Email, user.Password, user.FirstName, user.LastName, user.StatusID, user.RoleID)
 	if err != nil {
-		log.Printf("failed to create user due to: %s\n", err.Error())
+		logging.FromContext(ctx).Error("failed to create user", "error", err)
 		return 0, err
 	}
 
 	// Get the ID of the newly inserted user
 	userID, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("failed to fetch created user ID: %s\n", err.Error())
+		logging.FromContext(ctx).Error("failed to fetch created user ID", "error", err)
 		return 0, err
 	}
 
 	return int(userID), nil
 }
 
+// UpdateUser updates a user in db. The update only happens if the user is
+// still at user.Version, ErrVersionMismatch is returned otherwise.
 func UpdateUser(ctx context.Context, db *sql.DB, user *User) error {
 
-	query := "UPDATE users SET username=?, email=?, first_name=?, last_name=?, profile_picture=?, status_id=?, role_id=?, updated_at = CURRENT_TIMESTAMP WHERE id=?"
+	query := "UPDATE users SET username=?, email=?, first_name=?, last_name=?, status_id=?, role_id=?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id=? AND version=? AND deleted_at IS NULL"
+
+	result, err := db.ExecContext(ctx, query, user.Username, user.Email, user.FirstName, user.LastName, user.StatusID, user.RoleID, user.ID, user.Version)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update user", "error", err)
+		return err
+	}
+
+	return userVersionMatched(ctx, db, result, user.ID)
+}
 
-	_, err := db.ExecContext(ctx, query, user.Username, user.Email, user.FirstName, user.LastName, user.ProfilePicture, user.StatusID, user.RoleID, user.ID)
+// SetUserAvatar sets the avatar of the user userID to the image imageId, or
+// back to a generated avatar when imageId is nil.
+func SetUserAvatar(ctx context.Context, db *sql.DB, userID int, imageId *int) error {
+
+	result, err := db.ExecContext(ctx, "UPDATE users SET avatar_image_id = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND deleted_at IS NULL", imageId, userID)
 	if err != nil {
-		log.Printf("failed to update user due to: %s", err.Error())
+		logging.FromContext(ctx).Error("failed to set user avatar", "error", err)
 		return err
 	}
 
-	return nil
+	return requireAffected(ctx, result, ErrUserNotFound)
 }
 
+// UserExistsByEmail reports whether email is taken. Soft-deleted users still
+// hold on to their email until they are purged.
 func UserExistsByEmail(ctx context.Context, db *sql.DB, email string) (bool, error) {
 
 	var count int
@@ -95,6 +155,8 @@ func UserExistsByEmail(ctx context.Context, db *sql.DB, email string) (bool, err
 	return count > 0, nil
 }
 
+// UserExistsByUsername reports whether username is taken. Soft-deleted users
+// still hold on to their username until they are purged.
 func UserExistsByUsername(ctx context.Context, db *sql.DB, username string) (bool, error) {
 
 	var count int
@@ -107,13 +169,57 @@ func UserExistsByUsername(ctx context.Context, db *sql.DB, username string) (boo
 	return count > 0, nil
 }
 
-func DeleteUser(ctx context.Context, db *sql.DB, userID int) error {
+// DeleteUser soft deletes a user. The user is kept in db until it is purged and
+// can be brought back with RestoreUser. The user is only deleted if it is
+// still at version, ErrVersionMismatch is returned otherwise.
+func DeleteUser(ctx context.Context, db *sql.DB, userID, version int) error {
 
-	_, err := db.ExecContext(ctx, "DELETE FROM users WHERE ID = ?", userID)
+	result, err := db.ExecContext(ctx, "UPDATE users SET deleted_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND version = ? AND deleted_at IS NULL", userID, version)
 	if err != nil {
-		log.Printf("failed to delete user due to: %s\n", err.Error())
+		logging.FromContext(ctx).Error("failed to delete user", "error", err)
 		return err
 	}
 
-	return nil
+	return userVersionMatched(ctx, db, result, userID)
+}
+
+// userVersionMatched tells apart the reasons why a versioned statement on the
+// user userID didn't affect any rows.
+func userVersionMatched(ctx context.Context, db *sql.DB, result sql.Result, userID int) error {
+
+	err := requireAffected(ctx, result, ErrVersionMismatch)
+	if !errors.Is(err, ErrVersionMismatch) {
+		return err
+	}
+
+	if _, err := FindUserByID(ctx, db, userID, false); err != nil {
+		return err
+	}
+
+	return ErrVersionMismatch
+}
+
+// RestoreUser undoes the soft deletion of a user.
+func RestoreUser(ctx context.Context, db *sql.DB, userID int) error {
+
+	result, err := db.ExecContext(ctx, "UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL", userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to restore user", "error", err)
+		return err
+	}
+
+	return requireAffected(ctx, result, ErrUserNotFound)
+}
+
+// PurgeDeletedUsers permanently removes users that were soft deleted before
+// cutoff. The number of users removed is returned.
+func PurgeDeletedUsers(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+
+	result, err := db.ExecContext(ctx, "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to purge deleted users", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
 }
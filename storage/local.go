@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores files in a directory on the local filesystem.
+type Local struct {
+	Dir string
+	// BaseURL is the address the files in Dir are served from, such as
+	// "/uploads" when served with Handler.
+	BaseURL string
+}
+
+// NewLocal returns a Local storage in dir, creating it if needed.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// path returns the file path of key, refusing keys that would escape Dir.
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", errors.New("storage: invalid key " + key)
+	}
+
+	return filepath.Join(l.Dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes data to the file for key. The file is written under a temporary
+// name first so that readers never see a partial file.
+func (l *Local) Put(_ context.Context, key string, data []byte, _ string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get reads the file for key.
+func (l *Local) Get(_ context.Context, key string) ([]byte, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Delete removes the file for key.
+func (l *Local) Delete(_ context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// URL returns BaseURL followed by key.
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+// Handler serves the stored files. Directories aren't listed.
+func (l *Local) Handler() http.Handler {
+	files := http.FileServer(http.Dir(l.Dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	l := &Local{Dir: "/srv/uploads"}
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "images/3f2a9c.jpg", want: "/srv/uploads/images/3f2a9c.jpg"},
+		{key: "3f2a9c.jpg", want: "/srv/uploads/3f2a9c.jpg"},
+		{key: "../secret", wantErr: true},
+		{key: "images/../../secret", wantErr: true},
+		{key: "images/../3f2a9c.jpg", wantErr: true},
+		{key: "/etc/passwd", wantErr: true},
+		{key: "images//3f2a9c.jpg", wantErr: true},
+		{key: "images/", wantErr: true},
+		{key: "", wantErr: true},
+		{key: "..", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := l.path(test.key)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("path(%q) = %q, want an error", test.key, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("path(%q): %v", test.key, err)
+			continue
+		}
+
+		if want := filepath.FromSlash(test.want); got != want {
+			t.Errorf("path(%q) = %q, want %q", test.key, got, want)
+		}
+	}
+}
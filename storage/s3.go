@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 stores files in a bucket of an S3 compatible object store, such as AWS S3
+// or MinIO. Requests are path-style, https://endpoint/bucket/key, and signed
+// with AWS Signature Version 4.
+type S3 struct {
+	// Endpoint is the address of the object store, such as
+	// "https://s3.us-west-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	// PublicURL is the address the bucket's files are served from. Files
+	// are assumed to be served from the object store itself when empty.
+	PublicURL string
+	Client    *http.Client
+}
+
+// NewS3 returns an S3 storage for bucket at endpoint.
+func NewS3(endpoint, region, bucket, accessKeyId, secretAccessKey, publicURL string) *S3 {
+	return &S3{
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		Region:          region,
+		Bucket:          bucket,
+		AccessKeyId:     accessKeyId,
+		SecretAccessKey: secretAccessKey,
+		PublicURL:       strings.TrimSuffix(publicURL, "/"),
+		Client:          &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Put uploads data to the object key.
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	res, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return s.error(res, key)
+	}
+
+	return nil
+}
+
+// Get downloads the object key.
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, s.error(res, key)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// Delete removes the object key.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// S3 answers 204 whether or not the object existed, some compatible
+	// stores answer 404 for missing objects.
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK &&
+		res.StatusCode != http.StatusNotFound {
+		return s.error(res, key)
+	}
+
+	return nil
+}
+
+// URL returns the public address of the object key.
+func (s *S3) URL(key string) string {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + uriEncode(key, false)
+	}
+
+	return s.Endpoint + s.objectPath(key)
+}
+
+func (s *S3) objectPath(key string) string {
+	return "/" + uriEncode(s.Bucket, true) + "/" + uriEncode(key, false)
+}
+
+func (s *S3) error(res *http.Response, key string) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("storage: s3 %s %q: %s: %s", res.Request.Method, key, res.Status, bytes.TrimSpace(body))
+}
+
+// do sends a signed request for the object key.
+func (s *S3) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.Endpoint+s.objectPath(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the path exactly as it was signed.
+	req.URL.RawPath = s.objectPath(key)
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	s.sign(req, body, time.Now().UTC())
+
+	return s.Client.Do(req)
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to req. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyId, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	params := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes s the way SigV4 expects, leaving only unreserved
+// characters as is. Slashes are kept unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,23 @@
+// Package storage stores uploaded files, such as images, under a key.
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Storage stores files under keys such as "images/3f2a9c.jpg". Keys only
+// contain letters, digits, '/', '-', '_' and '.'.
+type Storage interface {
+	// Put stores data under key, replacing any file already stored there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the file stored under key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the file stored under key. Deleting a missing file
+	// isn't an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the public address of the file stored under key.
+	URL(key string) string
+}
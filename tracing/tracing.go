@@ -0,0 +1,94 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are only exported when
+// an exporter is configured, but trace context is always propagated with the
+// W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName identifies the server in traces, unless OTEL_SERVICE_NAME is
+// set.
+const ServiceName = "somos-backend"
+
+// NewProvider returns a tracer provider sending every span to exporter in
+// batches. Tests can pass a tracetest.InMemoryExporter and flush the provider
+// with ForceFlush before looking at the spans.
+func NewProvider(exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resources from the environment, such as OTEL_SERVICE_NAME, take
+	// precedence.
+	env, err := resource.New(context.Background(), resource.WithFromEnv())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err = resource.Merge(res, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// Install makes provider the global tracer provider and propagates trace
+// context with the W3C traceparent and baggage headers. A nil provider keeps
+// the global one, which records nothing by default.
+func Install(provider *sdktrace.TracerProvider) {
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Setup installs tracing with exporter, "none" or "otlp", sending spans to an
+// OpenTelemetry collector over OTLP/HTTP with the latter. The
+// collector's address and headers are read from the standard
+// OTEL_EXPORTER_OTLP_* variables. The returned function flushes and stops
+// the exporter.
+func Setup(ctx context.Context, exporter string) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+
+	switch exporter {
+	case "", "none":
+		Install(nil)
+		return noop, nil
+	case "otlp":
+		otlp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return noop, err
+		}
+
+		provider, err := NewProvider(otlp)
+		if err != nil {
+			return noop, err
+		}
+
+		Install(provider)
+		return provider.Shutdown, nil
+	default:
+		return noop, fmt.Errorf("unknown tracing exporter %q, expected none or otlp", exporter)
+	}
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/XSAM/otelsql"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeDriver stands in for the MySQL driver, answering every query with a
+// single row holding "1".
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeRows struct {
+	done bool
+}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (*fakeRows) Columns() []string { return []string{"value"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+
+	return nil
+}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := NewProvider(exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	Install(provider)
+
+	db, err := otelsql.Open("fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	router := mux.NewRouter()
+	router.Use(otelmux.Middleware(ServiceName))
+	router.HandleFunc("/events/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var value int
+		if err := db.QueryRowContext(r.Context(), "SELECT 1").Scan(&value); err != nil {
+			t.Errorf("query: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	const (
+		traceId      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanId = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/events/42", nil)
+	req.Header.Set("traceparent", "00-"+traceId+"-"+parentSpanId+"-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+
+	var server *tracetest.SpanStub
+	for i, span := range spans {
+		if span.SpanKind == trace.SpanKindServer {
+			server = &spans[i]
+		}
+	}
+	if server == nil {
+		t.Fatalf("no server span among %d spans", len(spans))
+	}
+
+	if server.Name != "/events/{id}" {
+		t.Errorf("server span name = %q, want the route template /events/{id}", server.Name)
+	}
+	if got := server.SpanContext.TraceID().String(); got != traceId {
+		t.Errorf("server span trace id = %s, want %s from traceparent", got, traceId)
+	}
+	if got := server.Parent.SpanID().String(); got != parentSpanId || !server.Parent.IsRemote() {
+		t.Errorf("server span parent = %s (remote %t), want remote %s from traceparent",
+			got, server.Parent.IsRemote(), parentSpanId)
+	}
+
+	var query *tracetest.SpanStub
+	for i, span := range spans {
+		if span.Name == string(otelsql.MethodConnQuery) {
+			query = &spans[i]
+		}
+	}
+	if query == nil {
+		t.Fatalf("no %s span among %d spans", otelsql.MethodConnQuery, len(spans))
+	}
+
+	if query.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("query span parent = %s, want the server span %s", query.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+	if query.SpanContext.TraceID() != server.SpanContext.TraceID() {
+		t.Errorf("query span trace id = %s, want %s", query.SpanContext.TraceID(), server.SpanContext.TraceID())
+	}
+}
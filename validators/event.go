@@ -3,6 +3,9 @@ package validators
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/somos831/somos-backend/models"
 )
@@ -32,6 +35,25 @@ func (v *Validator) ValidateNewEvent(ctx context.Context, ev models.Event) error
 		}
 	}
 
+	if len(ev.OrganizationIds) > 10 {
+		errs.Add("organization_ids", "an event can have at most 10 hosts")
+	}
+
+	for _, orgId := range ev.OrganizationIds {
+		organizationExists, err := v.valuesExist(ctx, "organizations", "id", orgId)
+		if err != nil {
+			return err
+		}
+
+		if !organizationExists {
+			errs.Add("organization_ids", fmt.Sprintf("organization_id %d does not exist", orgId))
+		}
+	}
+
+	if ev.OrganizationId != nil && !slices.Contains(ev.OrganizationIds, *ev.OrganizationId) {
+		errs.Add("organization_id", "organization_id must be one of organization_ids")
+	}
+
 	if ev.ImageId != nil {
 		imageExists, err := v.valuesExist(ctx, "images", "id", ev.ImageId)
 		if err != nil {
@@ -44,7 +66,7 @@ func (v *Validator) ValidateNewEvent(ctx context.Context, ev models.Event) error
 	}
 
 	if ev.LocationId != nil {
-		locationExists, err := v.valuesExist(ctx, "locations", "id", ev.LocationId)
+		locationExists, err := v.activeValuesExist(ctx, "locations", "id", ev.LocationId)
 		if err != nil {
 			return err
 		}
@@ -84,9 +106,68 @@ func (v *Validator) ValidateNewEvent(ctx context.Context, ev models.Event) error
 			"additional_url cannot be longer than 255 characters")
 	}
 
+	validateAttendance(ev, errs)
+
 	if errs.None() {
 		return nil
 	}
 
 	return errs
 }
+
+// validateAttendance checks that the event has the details needed to attend it
+// in person and/or online, depending on its attendance mode.
+func validateAttendance(ev models.Event, errs ValidationError) {
+	switch ev.AttendanceMode {
+	case models.AttendanceInPerson:
+		if ev.OnlineUrl != nil || ev.OnlinePlatform != nil || ev.OnlineAccessInstructions != nil {
+			errs.Add("attendance_mode",
+				"online details can only be given for online or hybrid events")
+		}
+
+		if ev.CategoryId == models.CategoryVirtual {
+			errs.Add("attendance_mode", "virtual events must be online or hybrid")
+		}
+
+	case models.AttendanceOnline, models.AttendanceHybrid:
+		if ev.OnlineUrl == nil || *ev.OnlineUrl == "" {
+			errs.Add("online_url", "online_url is required for online and hybrid events")
+		} else if len(*ev.OnlineUrl) > 255 {
+			errs.Add("online_url", "online_url cannot be longer than 255 characters")
+		} else if !isWebURL(*ev.OnlineUrl) {
+			errs.Add("online_url", "online_url must be an http or https URL")
+		}
+
+		if ev.OnlinePlatform == nil {
+			errs.Add("online_platform",
+				"online_platform is required for online and hybrid events")
+		} else if !slices.Contains(models.OnlinePlatforms, *ev.OnlinePlatform) {
+			errs.Add("online_platform", fmt.Sprintf("online_platform must be one of %s",
+				strings.Join(models.OnlinePlatforms, ", ")))
+		}
+
+		if ev.OnlineAccessInstructions != nil && len(*ev.OnlineAccessInstructions) > 1500 {
+			errs.Add("online_access_instructions",
+				"online_access_instructions cannot be longer than 1500 characters")
+		}
+
+		if ev.AttendanceMode == models.AttendanceHybrid &&
+			ev.LocationId == nil && ev.LocationDetails == nil {
+			errs.Add("location_id",
+				"hybrid events need a location_id or location_details")
+		}
+
+	default:
+		errs.Add("attendance_mode",
+			"attendance_mode must be one of in_person, online or hybrid")
+	}
+}
+
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
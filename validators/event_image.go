@@ -0,0 +1,28 @@
+package validators
+
+import "github.com/somos831/somos-backend/models"
+
+// ValidateEventImage validates a new or updated photo in an event's gallery.
+func (v *Validator) ValidateEventImage(img models.EventImage) error {
+	errs := ValidationError{}
+
+	if img.Caption != nil && len(*img.Caption) > 500 {
+		errs.Add("caption", "caption cannot be longer than 500 characters")
+	}
+
+	if img.Photographer != nil && len(*img.Photographer) > 100 {
+		errs.Add("photographer", "photographer cannot be longer than 100 characters")
+	}
+
+	if img.Alt == "" {
+		errs.Add("alt", "alt text describing the image is required")
+	} else if len(img.Alt) > 150 {
+		errs.Add("alt", "alt cannot be longer than 150 characters")
+	}
+
+	if errs.None() {
+		return nil
+	}
+
+	return errs
+}
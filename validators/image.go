@@ -0,0 +1,38 @@
+package validators
+
+import "github.com/somos831/somos-backend/models"
+
+// Limits on the dimensions of uploaded images. MaxImagePixels guards against
+// small files that decode into huge images.
+const (
+	MaxImageDimension = 8000
+	MaxImagePixels    = 40_000_000
+)
+
+func (v *Validator) NewImage(img models.Image) error {
+	errs := ValidationError{}
+
+	if img.Alt == "" {
+		errs.Add("alt", "alt text describing the image is required")
+	} else if len(img.Alt) > 150 {
+		errs.Add("alt", "alt cannot be longer than 150 characters")
+	}
+
+	if len(img.Filename) > 255 {
+		errs.Add("filename", "filename cannot be longer than 255 characters")
+	}
+
+	if img.Width < 1 || img.Height < 1 {
+		errs.Add("image", "image must be at least 1 pixel wide and tall")
+	} else if img.Width > MaxImageDimension || img.Height > MaxImageDimension {
+		errs.Add("image", "image cannot be wider or taller than 8000 pixels")
+	} else if img.Width*img.Height > MaxImagePixels {
+		errs.Add("image", "image cannot have more than 40 megapixels")
+	}
+
+	if errs.None() {
+		return nil
+	}
+
+	return errs
+}
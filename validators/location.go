@@ -13,6 +13,34 @@ func (v *Validator) NewLocation(location models.Location) error {
 		errs.Add("address", "location address cannot be empty")
 	}
 
+	if (location.Latitude == nil) != (location.Longitude == nil) {
+		errs.Add("latitude", "latitude and longitude must be given together")
+	}
+
+	if location.Latitude != nil && (*location.Latitude < -90 || *location.Latitude > 90) {
+		errs.Add("latitude", "latitude must be between -90 and 90")
+	}
+
+	if location.Longitude != nil && (*location.Longitude < -180 || *location.Longitude > 180) {
+		errs.Add("longitude", "longitude must be between -180 and 180")
+	}
+
+	if location.Capacity != nil && *location.Capacity < 1 {
+		errs.Add("capacity", "capacity must be a positive number")
+	}
+
+	if location.ParkingNotes != nil && len(*location.ParkingNotes) > 500 {
+		errs.Add("parking_notes", "parking_notes cannot be longer than 500 characters")
+	}
+
+	if location.TransitNotes != nil && len(*location.TransitNotes) > 500 {
+		errs.Add("transit_notes", "transit_notes cannot be longer than 500 characters")
+	}
+
+	if len(location.MapURL) > 255 {
+		errs.Add("map_url", "map_url cannot be longer than 255 characters")
+	}
+
 	if errs.None() {
 		return nil
 	}
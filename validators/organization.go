@@ -0,0 +1,84 @@
+package validators
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+
+	"github.com/somos831/somos-backend/models"
+)
+
+// ValidateOrganization validates a new or updated organization. Organization
+// names must be unique, org.Id is ignored when checking so an organization
+// keeps its own name on update.
+func (v *Validator) ValidateOrganization(ctx context.Context, org models.Organization) error {
+	errs := ValidationError{}
+
+	if org.Name == "" {
+		errs.Add("name", "name cannot be empty")
+	} else if len(org.Name) > 100 {
+		errs.Add("name", "name cannot be longer than 100 characters")
+	} else {
+		row := v.DB.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM organizations WHERE name = ? AND id != ?`, org.Name, org.Id)
+
+		var count int
+		if err := row.Scan(&count); err != nil {
+			return err
+		}
+
+		if count > 0 {
+			errs.Add("name", "an organization with this name already exists")
+		}
+	}
+
+	if org.Description != nil && len(*org.Description) > 1500 {
+		errs.Add("description", "description cannot be longer than 1500 characters")
+	}
+
+	if org.Website != nil {
+		if len(*org.Website) > 255 {
+			errs.Add("website", "website cannot be longer than 255 characters")
+		} else if !isWebURL(*org.Website) {
+			errs.Add("website", "website must be an http or https URL")
+		}
+	}
+
+	if org.LogoImageId != nil {
+		imageExists, err := v.valuesExist(ctx, "images", "id", org.LogoImageId)
+		if err != nil {
+			return err
+		}
+
+		if !imageExists {
+			errs.Add("logo_image_id", fmt.Sprintf("logo_image_id %d does not exist", *org.LogoImageId))
+		}
+	}
+
+	if org.ContactEmail != nil {
+		if len(*org.ContactEmail) > 100 {
+			errs.Add("contact_email", "contact_email cannot be longer than 100 characters")
+		} else if _, err := mail.ParseAddress(*org.ContactEmail); err != nil {
+			errs.Add("contact_email", "contact_email must be a valid email address")
+		}
+	}
+
+	if len(org.SocialLinks) > 10 {
+		errs.Add("social_links", "an organization can have at most 10 social links")
+	}
+	for network, link := range org.SocialLinks {
+		if network == "" || len(network) > 50 {
+			errs.Add("social_links", "social network names must be 1 to 50 characters long")
+		}
+
+		if len(link) > 255 || !isWebURL(link) {
+			errs.Add("social_links", fmt.Sprintf("%s link must be an http or https URL of at most 255 characters", network))
+		}
+	}
+
+	if errs.None() {
+		return nil
+	}
+
+	return errs
+}
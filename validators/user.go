@@ -46,7 +46,7 @@ func (v *Validator) ValidateUpdatedFields(ctx context.Context, user models.User)
 	}
 
 	// Get current values: email and username
-	userRec, err := models.FindUserByID(ctx, v.DB, user.ID)
+	userRec, err := models.FindUserByID(ctx, v.DB, user.ID, false)
 	if err != nil {
 		return err
 	}
@@ -81,11 +81,6 @@ func (v *Validator) ValidateUpdatedFields(ctx context.Context, user models.User)
 		}
 	}
 
-	err = models.UpdateUser(ctx, v.DB, &user)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -55,3 +55,19 @@ func (m *Validator) valuesExist(ctx context.Context, table, col string, val inte
 
 	return count > 0, nil
 }
+
+// activeValuesExist is like valuesExist but ignores rows that have been soft
+// deleted.
+//
+// SELECT COUNT(*) FROM table WHERE col = val AND deleted_at IS NULL
+func (m *Validator) activeValuesExist(ctx context.Context, table, col string, val interface{}) (bool, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = ? AND deleted_at IS NULL`, table, col)
+	row := m.DB.QueryRowContext(ctx, query, val)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}